@@ -1,16 +1,21 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 
 	"github.com/alecthomas/kong"
+	"gopkg.in/yaml.v3"
 
 	"github.com/aserto-dev/go-sample-project/pkg/app"
 	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	cc_context "github.com/aserto-dev/go-sample-project/pkg/cc/context"
 	"github.com/aserto-dev/go-sample-project/pkg/version"
 )
 
 type RunCmd struct {
+	Role string `help:"servers to run: all, grpc or gateway (overrides api.role)" placeholder:"ROLE"`
 }
 
 func (r *RunCmd) Run(globals *Globals) error {
@@ -20,7 +25,11 @@ func (r *RunCmd) Run(globals *Globals) error {
 		os.Stdout,
 		os.Stderr,
 		config.Path(configFile),
-		func(*config.Config) {})
+		func(cfg *config.Config) {
+			if r.Role != "" {
+				cfg.API.Role = r.Role
+			}
+		})
 
 	defer func() {
 		if cleanup != nil {
@@ -36,39 +45,71 @@ func (r *RunCmd) Run(globals *Globals) error {
 		return err
 	}
 
-	<-appInstance.Context.Done()
-
-	return nil
+	upgrades := cc_context.UpgradeSignal()
+	// the upgrade runs in the background, so shutdown is still handled while
+	// the new process starts. It's nil unless an upgrade is running
+	var upgraded chan error
+	for {
+		select {
+		case <-appInstance.Context.Done():
+			if upgraded != nil {
+				// the new process is stopped, as the upgrade uses the same context
+				<-upgraded
+			}
+			appInstance.Logger.Info().Msg("shutting down")
+			return nil
+		case <-upgrades:
+			if upgraded != nil {
+				appInstance.Logger.Warn().Msg("upgrade already in progress")
+				continue
+			}
+
+			appInstance.Logger.Info().Msg("upgrading")
+			upgraded = make(chan error, 1)
+			go func(result chan<- error) {
+				result <- appInstance.Server.Upgrade(appInstance.Context)
+			}(upgraded)
+		case err := <-upgraded:
+			upgraded = nil
+			if err != nil {
+				appInstance.Logger.Error().Err(err).Msg("upgrade failed, still serving")
+				continue
+			}
+
+			// the deferred cleanup drains the connections of this process
+			appInstance.Logger.Info().Msg("handed off to the new process, shutting down")
+			return nil
+		}
+	}
 }
 
 type VersionCmd struct {
+	Output string `short:"o" enum:"text,json,yaml" default:"text" help:"output format: text, json or yaml"`
 }
 
-func (cmd *VersionCmd) Run(globals *Globals) error {
-	configFile := globals.Config
-
-	appInstance, cleanup, err := app.BuildGoSampleProject(
-		os.Stdout,
-		os.Stderr,
-		config.Path(configFile),
-		func(*config.Config){})
-
-	defer func() {
-		if cleanup != nil {
-			cleanup()
+// Run prints the version. It doesn't read the config, so it works anywhere.
+func (cmd *VersionCmd) Run() error {
+	info := version.GetInfo()
+
+	switch cmd.Output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(info)
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		defer encoder.Close()
+
+		return encoder.Encode(info)
+	default:
+		fmt.Printf("go Sample Project %s\n", info)
+		for _, dep := range info.Dependencies {
+			fmt.Printf("  %s %s\n", dep.Path, dep.Version)
 		}
-	}()
-	if err != nil {
-		return err
-	}
 
-	appInstance.Logger.Info().
-		Str("version",  version.GetInfo().Version).
-		Str("date",  version.GetInfo().Date).
-		Str("commit",  version.GetInfo().Commit).
-		Msg("go Sample Project")
-
-	return nil
+		return nil
+	}
 }
 
 type Globals struct {
@@ -77,7 +118,7 @@ type Globals struct {
 
 type CLI struct {
 	Globals
-	Run RunCmd `cmd:"" help:"Run go Sample Project service"`
+	Run     RunCmd     `cmd:"" help:"Run go Sample Project service. SIGINT, SIGTERM and SIGHUP stop it gracefully, SIGUSR2 hands its listeners off to a new process (Linux)"`
 	Version VersionCmd `cmd:"" help:"Print version and exit"`
 }
 
@@ -0,0 +1,278 @@
+//go:build linux
+// +build linux
+
+package main_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	"github.com/aserto-dev/go-sample-project/pkg/testharness"
+)
+
+func TestSystemd(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	p := testharness.NewProcess(t, func(cfg *config.Config) {
+		cfg.API.GRPCWeb.Enabled = false
+	})
+	defer p.Cleanup()
+	assert := require.New(t)
+
+	// the sockets are passed in the order of LISTEN_FDNAMES, starting with fd 3.
+	// The grpc-web socket isn't used, its server is disabled
+	names := []string{"grpc", "gateway", "health", "grpc-web"}
+	var unused net.Listener
+	for _, name := range names {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(err)
+		defer lis.Close()
+
+		f, err := lis.(*net.TCPListener).File()
+		assert.NoError(err)
+		defer f.Close()
+		p.Cmd.ExtraFiles = append(p.Cmd.ExtraFiles, f)
+
+		switch name {
+		case "grpc":
+			p.GRPCAddress = lis.Addr().String()
+		case "gateway":
+			p.GatewayAddress = lis.Addr().String()
+		case "health":
+			p.HealthAddress = lis.Addr().String()
+		case "grpc-web":
+			unused = lis
+		}
+	}
+
+	notifySocket := filepath.Join(t.TempDir(), "notify.sock")
+	notify, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: notifySocket, Net: "unixgram"})
+	assert.NoError(err)
+	defer notify.Close()
+
+	notifications := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := notify.Read(buf)
+			if err != nil {
+				close(notifications)
+				return
+			}
+			notifications <- string(buf[:n])
+		}
+	}()
+
+	p.Cmd.Env = append(os.Environ(),
+		"LISTEN_FDS=4",
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+		"NOTIFY_SOCKET="+notifySocket,
+		"WATCHDOG_USEC=200000",
+	)
+	// LISTEN_PID is the pid of the shell, which is replaced by the binary
+	p.Cmd.Args = append([]string{"/bin/sh", "-c", `export LISTEN_PID=$$; exec "$0" "$@"`}, p.Cmd.Args...)
+	p.Cmd.Path = "/bin/sh"
+
+	// Act
+	p.Start()
+	unusedAddress := unused.Addr().String()
+	// only the process has the socket open now
+	assert.NoError(unused.Close())
+	assert.NoError(p.Cmd.ExtraFiles[3].Close())
+	p.WaitReady(30 * time.Second)
+	ready := waitForNotification(t, notifications, "READY=1")
+	watchdog := waitForNotification(t, notifications, "WATCHDOG=1")
+	_, dialErr := net.Dial("tcp", unusedAddress)
+
+	p.Signal(syscall.SIGTERM)
+	stopping := waitForNotification(t, notifications, "STOPPING=1")
+	code := p.Wait(30 * time.Second)
+
+	// Assert
+	assert.True(ready)
+	assert.True(watchdog)
+	assert.True(stopping)
+	assert.Equal(0, code)
+	assert.ErrorIs(dialErr, syscall.ECONNREFUSED)
+	p.AssertLogged(testharness.LogQuery{
+		Level:   "warn",
+		Message: "closing activated socket that isn't used by any server",
+		Fields:  map[string]interface{}{"name": "grpc-web"},
+	})
+	p.AssertNoErrorLogs()
+}
+
+// waitForNotification returns true once the expected state is received.
+func waitForNotification(t *testing.T, notifications <-chan string, expected string) bool {
+	timeout := time.After(30 * time.Second)
+	for {
+		select {
+		case state := <-notifications:
+			if state == expected {
+				return true
+			}
+		case <-timeout:
+			t.Errorf("systemd wasn't notified with %s", expected)
+			return false
+		}
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	p := testharness.StartProcess(t, func(cfg *config.Config) {
+		cfg.API.Connect.Enabled = true
+	})
+	defer p.Cleanup()
+	assert := require.New(t)
+
+	// the request is in flight until the rest of its body is sent
+	conn, err := tls.Dial("tcp", p.GatewayAddress, gatewayTLSConfig(t, p))
+	assert.NoError(err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST /aserto.common.info.v1.Info/Info HTTP/1.1\r\n" +
+		"Host: " + p.GatewayAddress + "\r\n" +
+		"Content-Type: application/json\r\n" +
+		"Connect-Protocol-Version: 1\r\n" +
+		"Content-Length: 2\r\n\r\n{"))
+	assert.NoError(err)
+
+	// Act
+	p.Signal(syscall.SIGUSR2)
+	ready := p.WaitForLog(testharness.LogQuery{Level: "info", Message: "new process is ready"}, 60*time.Second)
+	pid, ok := ready["pid"].(float64)
+	assert.True(ok)
+	defer func() {
+		_ = syscall.Kill(int(pid), syscall.SIGKILL)
+	}()
+
+	_, err = conn.Write([]byte("}"))
+	assert.NoError(err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	assert.NoError(err)
+	resp.Body.Close()
+
+	code := p.Wait(30 * time.Second)
+
+	// Assert
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(0, code)
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, healthStatus(t, p.HealthAddress))
+	p.AssertLogged(testharness.LogQuery{Level: "info", Message: "handed off to the new process, shutting down"})
+	p.AssertNoErrorLogs()
+}
+
+func TestUpgradeRollback(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	p := testharness.StartProcess(t, func(cfg *config.Config) {})
+	defer p.Cleanup()
+	assert := require.New(t)
+
+	// the new process fails to read the config
+	assert.NoError(os.WriteFile(p.ConfigPath, []byte("api: ["), 0o600))
+
+	// Act
+	p.Signal(syscall.SIGUSR2)
+	p.WaitForLog(testharness.LogQuery{Level: "error", Message: "upgrade failed, still serving"}, 60*time.Second)
+	status := healthStatus(t, p.HealthAddress)
+
+	p.Signal(syscall.SIGTERM)
+	code := p.Wait(30 * time.Second)
+
+	// Assert
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, status)
+	assert.Equal(0, code)
+	p.AssertLogged(testharness.LogQuery{Level: "info", Message: "shutting down"})
+}
+
+func TestUpgradeShutdown(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	p := testharness.StartProcess(t, func(cfg *config.Config) {})
+	defer p.Cleanup()
+	assert := require.New(t)
+
+	// the new process never becomes ready, its upstream isn't listening
+	discard := zerolog.New(io.Discard)
+	cfg, err := config.NewConfig(config.Path(p.ConfigPath), &discard, func(cfg *config.Config) {
+		cfg.API.Role = config.RoleGateway
+		cfg.API.Gateway.Upstream.Mode = config.UpstreamRemote
+		cfg.API.Gateway.Upstream.Address = "127.0.0.1:1"
+	}, nil)
+	assert.NoError(err)
+	buf, err := json.Marshal(cfg)
+	assert.NoError(err)
+	assert.NoError(os.WriteFile(p.ConfigPath, buf, 0o600))
+
+	// Act
+	p.Signal(syscall.SIGUSR2)
+	started := p.WaitForLog(testharness.LogQuery{Level: "info", Message: "started new process, waiting for it to be ready"}, 60*time.Second)
+	pid, ok := started["pid"].(float64)
+	assert.True(ok)
+	defer func() {
+		_ = syscall.Kill(int(pid), syscall.SIGKILL)
+	}()
+
+	p.Signal(syscall.SIGTERM)
+	code := p.Wait(30 * time.Second)
+
+	// Assert
+	assert.Equal(0, code)
+	p.AssertLogged(testharness.LogQuery{Level: "info", Message: "shutting down"})
+	// the new process was killed
+	assert.Eventually(func() bool {
+		return syscall.Kill(int(pid), 0) == syscall.ESRCH
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+// gatewayTLSConfig trusts the certificates of the gateway of p.
+func gatewayTLSConfig(t *testing.T, p *testharness.Process) *tls.Config {
+	caCert, err := os.ReadFile(filepath.Join(filepath.Dir(p.ConfigPath), "gateway-ca.crt"))
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caCert)
+
+	return &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+}
+
+// healthStatus returns the readiness of the server listening on the health address.
+func healthStatus(t *testing.T, address string) healthpb.HealthCheckResponse_ServingStatus {
+	assert := require.New(t)
+
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "grpc.health.v1.go-sample-project"})
+	assert.NoError(err)
+
+	return resp.GetStatus()
+}
@@ -0,0 +1,91 @@
+package main_test
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	"github.com/aserto-dev/go-sample-project/pkg/testharness"
+	"github.com/aserto-dev/go-sample-project/pkg/version"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testharness.RemoveBinary()
+	os.Exit(code)
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	for _, sig := range []syscall.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP} {
+		sig := sig
+		t.Run(sig.String(), func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange
+			p := testharness.StartProcess(t, func(cfg *config.Config) {})
+			defer p.Cleanup()
+			assert := require.New(t)
+
+			// Act
+			p.Signal(sig)
+			code := p.Wait(30 * time.Second)
+
+			// Assert
+			assert.Equal(0, code)
+			p.AssertLogged(testharness.LogQuery{Level: "info", Message: "shutting down"})
+			p.AssertLogged(testharness.LogQuery{Level: "info", Message: "Server stopping."})
+			p.AssertNoErrorLogs()
+		})
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	p := testharness.RunProcess(t, func(cfg *config.Config) {}, "--role", "unknown")
+	defer p.Cleanup()
+	assert := require.New(t)
+
+	// Act
+	code := p.Wait(30 * time.Second)
+
+	// Assert
+	assert.Equal(1, code)
+	p.AssertLogged(testharness.LogQuery{Message: "unknown role 'unknown'"})
+}
+
+func TestVersionCommand(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	bin := testharness.BuildBinary(t)
+	assert := require.New(t)
+
+	// Act
+	// the config isn't read
+	out, err := exec.Command(bin, "--config", filepath.Join(t.TempDir(), "missing.yaml"), "version", "--output", "json").Output() // nolint:gosec // test binary
+
+	// Assert
+	assert.NoError(err)
+
+	info := version.Info{}
+	assert.NoError(json.Unmarshal(out, &info))
+	assert.NotEmpty(info.Version)
+	assert.NotEmpty(info.Commit)
+	assert.NotEmpty(info.Date)
+	assert.NotEmpty(info.GoVersion)
+
+	paths := []string{}
+	for _, dep := range info.Dependencies {
+		paths = append(paths, dep.Path)
+	}
+	assert.Contains(paths, "github.com/alecthomas/kong")
+}
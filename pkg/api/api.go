@@ -0,0 +1,4 @@
+// Package api contains the code generated from the proto files in /proto.
+package api
+
+//go:generate buf generate --template ../../proto/buf.gen.yaml --path ../../proto/api/go_sample_project --output ../.. ../../proto
@@ -0,0 +1,103 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: go_sample_project/info/v1/runtime_info.proto
+
+package info
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// RuntimeInfoClient is the client API for RuntimeInfo service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RuntimeInfoClient interface {
+	RuntimeInfo(ctx context.Context, in *RuntimeInfoRequest, opts ...grpc.CallOption) (*RuntimeInfoResponse, error)
+}
+
+type runtimeInfoClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRuntimeInfoClient(cc grpc.ClientConnInterface) RuntimeInfoClient {
+	return &runtimeInfoClient{cc}
+}
+
+func (c *runtimeInfoClient) RuntimeInfo(ctx context.Context, in *RuntimeInfoRequest, opts ...grpc.CallOption) (*RuntimeInfoResponse, error) {
+	out := new(RuntimeInfoResponse)
+	err := c.cc.Invoke(ctx, "/go_sample_project.info.v1.RuntimeInfo/RuntimeInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RuntimeInfoServer is the server API for RuntimeInfo service.
+// All implementations should embed UnimplementedRuntimeInfoServer
+// for forward compatibility
+type RuntimeInfoServer interface {
+	RuntimeInfo(context.Context, *RuntimeInfoRequest) (*RuntimeInfoResponse, error)
+}
+
+// UnimplementedRuntimeInfoServer should be embedded to have forward compatible implementations.
+type UnimplementedRuntimeInfoServer struct {
+}
+
+func (UnimplementedRuntimeInfoServer) RuntimeInfo(context.Context, *RuntimeInfoRequest) (*RuntimeInfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RuntimeInfo not implemented")
+}
+
+// UnsafeRuntimeInfoServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RuntimeInfoServer will
+// result in compilation errors.
+type UnsafeRuntimeInfoServer interface {
+	mustEmbedUnimplementedRuntimeInfoServer()
+}
+
+func RegisterRuntimeInfoServer(s grpc.ServiceRegistrar, srv RuntimeInfoServer) {
+	s.RegisterService(&RuntimeInfo_ServiceDesc, srv)
+}
+
+func _RuntimeInfo_RuntimeInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RuntimeInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RuntimeInfoServer).RuntimeInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/go_sample_project.info.v1.RuntimeInfo/RuntimeInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RuntimeInfoServer).RuntimeInfo(ctx, req.(*RuntimeInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RuntimeInfo_ServiceDesc is the grpc.ServiceDesc for RuntimeInfo service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RuntimeInfo_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "go_sample_project.info.v1.RuntimeInfo",
+	HandlerType: (*RuntimeInfoServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RuntimeInfo",
+			Handler:    _RuntimeInfo_RuntimeInfo_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "go_sample_project/info/v1/runtime_info.proto",
+}
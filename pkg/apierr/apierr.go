@@ -0,0 +1,115 @@
+package apierr
+
+import (
+	"context"
+	"fmt"
+
+	protov1 "github.com/golang/protobuf/proto" // nolint:staticcheck // required by status.WithDetails
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain is the error domain reported in the ErrorInfo details of all errors
+// created by this package.
+const Domain = "go-sample-project"
+
+// Reasons reported in the ErrorInfo details, they are stable and can be used
+// by clients to identify errors.
+const (
+	ReasonNotFound     = "NOT_FOUND"
+	ReasonConflict     = "CONFLICT"
+	ReasonValidation   = "VALIDATION_FAILED"
+	ReasonPrecondition = "PRECONDITION_FAILED"
+	ReasonInternal     = "INTERNAL"
+)
+
+// NotFound returns an error that signals that a resource doesn't exist.
+func NotFound(resourceType, name string) error {
+	return newError(codes.NotFound, ReasonNotFound,
+		fmt.Sprintf("%s %q not found", resourceType, name),
+		&errdetails.ResourceInfo{ResourceType: resourceType, ResourceName: name},
+	)
+}
+
+// Conflict returns an error that signals that a resource can't be created or
+// updated because it conflicts with an existing one.
+func Conflict(resourceType, name, description string) error {
+	return newError(codes.AlreadyExists, ReasonConflict,
+		fmt.Sprintf("%s %q conflicts with an existing resource", resourceType, name),
+		&errdetails.ResourceInfo{ResourceType: resourceType, ResourceName: name, Description: description},
+	)
+}
+
+// Validation returns an error that describes which fields of a request are invalid.
+func Validation(message string, violations ...*errdetails.BadRequest_FieldViolation) error {
+	return newError(codes.InvalidArgument, ReasonValidation, message,
+		&errdetails.BadRequest{FieldViolations: violations},
+	)
+}
+
+// FieldViolation describes why a single request field is invalid.
+func FieldViolation(field, description string) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{Field: field, Description: description}
+}
+
+// Precondition returns an error that signals that the system is not in a state
+// required for the operation.
+func Precondition(message string, violations ...*errdetails.PreconditionFailure_Violation) error {
+	return newError(codes.FailedPrecondition, ReasonPrecondition, message,
+		&errdetails.PreconditionFailure{Violations: violations},
+	)
+}
+
+// PreconditionViolation describes a single failed precondition.
+func PreconditionViolation(violationType, subject, description string) *errdetails.PreconditionFailure_Violation {
+	return &errdetails.PreconditionFailure_Violation{Type: violationType, Subject: subject, Description: description}
+}
+
+// Status returns the gRPC status of err, following wrapped errors.
+// Errors that don't carry a status are reported as Internal, without leaking
+// their message to clients.
+func Status(err error) *status.Status {
+	if err == nil {
+		return nil
+	}
+
+	var se interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &se) {
+		return se.GRPCStatus()
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.New(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.New(codes.DeadlineExceeded, err.Error())
+	}
+
+	st, detailsErr := status.New(codes.Internal, "internal error").
+		WithDetails(&errdetails.ErrorInfo{Reason: ReasonInternal, Domain: Domain})
+	if detailsErr != nil {
+		return status.New(codes.Internal, "internal error")
+	}
+
+	return st
+}
+
+// HasStatus returns true if err, or any error it wraps, carries a gRPC status.
+func HasStatus(err error) bool {
+	var se interface{ GRPCStatus() *status.Status }
+	return errors.As(err, &se)
+}
+
+func newError(code codes.Code, reason, message string, details ...protov1.Message) error {
+	st := status.New(code, message)
+
+	details = append([]protov1.Message{&errdetails.ErrorInfo{Reason: reason, Domain: Domain}}, details...)
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
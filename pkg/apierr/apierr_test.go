@@ -0,0 +1,55 @@
+package apierr_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+
+	"github.com/aserto-dev/go-sample-project/pkg/apierr"
+)
+
+func TestDomainErrors(t *testing.T) {
+	assert := require.New(t)
+
+	st := apierr.Status(apierr.NotFound("policy", "p1"))
+	assert.Equal(codes.NotFound, st.Code())
+	assert.Equal(`policy "p1" not found`, st.Message())
+	assert.Len(st.Details(), 2)
+	assert.Equal(apierr.ReasonNotFound, st.Details()[0].(*errdetails.ErrorInfo).Reason)
+	assert.Equal("p1", st.Details()[1].(*errdetails.ResourceInfo).ResourceName)
+
+	st = apierr.Status(apierr.Conflict("policy", "p1", "name is taken"))
+	assert.Equal(codes.AlreadyExists, st.Code())
+
+	st = apierr.Status(apierr.Validation("invalid policy",
+		apierr.FieldViolation("name", "must not be empty"),
+		apierr.FieldViolation("owner", "unknown user"),
+	))
+	assert.Equal(codes.InvalidArgument, st.Code())
+	assert.Len(st.Details()[1].(*errdetails.BadRequest).FieldViolations, 2)
+
+	st = apierr.Status(apierr.Precondition("policy is locked", apierr.PreconditionViolation("LOCK", "p1", "locked by u1")))
+	assert.Equal(codes.FailedPrecondition, st.Code())
+	assert.Equal("LOCK", st.Details()[1].(*errdetails.PreconditionFailure).Violations[0].Type)
+}
+
+func TestStatus(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Nil(apierr.Status(nil))
+
+	wrapped := errors.Wrap(apierr.NotFound("policy", "p1"), "failed to load policy")
+	assert.True(apierr.HasStatus(wrapped))
+	assert.Equal(codes.NotFound, apierr.Status(wrapped).Code())
+
+	bare := errors.New("connection to db refused")
+	assert.False(apierr.HasStatus(bare))
+	assert.Equal(codes.Internal, apierr.Status(bare).Code())
+	assert.Equal("internal error", apierr.Status(bare).Message())
+
+	assert.Equal(codes.DeadlineExceeded, apierr.Status(errors.Wrap(context.DeadlineExceeded, "timeout")).Code())
+}
@@ -1,26 +1,47 @@
 package app_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"io"
+	"net"
 	"net/http"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	info "github.com/aserto-dev/go-grpc/aserto/common/info/v1"
+	runtimeinfo "github.com/aserto-dev/go-sample-project/pkg/api/info/v1"
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
 	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
 	"github.com/aserto-dev/go-sample-project/pkg/testharness"
+	"github.com/aserto-dev/go-utils/testutil"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestInfoEndpoint(t *testing.T) {
+	t.Parallel()
+
 	// Arrange
 	h := testharness.Setup(t, func(cfg *config.Config) {})
 	defer h.Cleanup()
 	assert := require.New(t)
 
 	// Act
-	client := h.CreateClient()
-	url := "https://127.0.0.1:8383/api/v1/info"
+	client := h.CreateClient(t)
+	url := "https://" + h.GatewayAddress + "/api/v1/info"
 	req, err := http.NewRequest("GET", url, bytes.NewBuffer([]byte{}))
 	assert.NoError(err)
 	req.Header.Set("Content-Type", "application/json")
@@ -40,10 +61,20 @@ func TestInfoEndpoint(t *testing.T) {
 		Arch    string `json:"arch"`
 	}
 
+	type System struct {
+		InstanceID string `json:"instance_id"`
+		CreatedAt  string `json:"created_at"`
+	}
+
+	type Version struct {
+		System int    `json:"system"`
+		Schema string `json:"schema"`
+	}
+
 	type Response struct {
-		System  string `json:"system"`
-		Version string `json:"version"`
-		Build   Build  `json:"build"`
+		System  System  `json:"system"`
+		Version Version `json:"version"`
+		Build   Build   `json:"build"`
 	}
 
 	decoder := json.NewDecoder(bytes.NewReader(body))
@@ -54,6 +85,14 @@ func TestInfoEndpoint(t *testing.T) {
 	assert.NoError(err)
 
 	expected := Response{
+		System: System{
+			InstanceID: result.System.InstanceID,
+			CreatedAt:  result.System.CreatedAt,
+		},
+		Version: Version{
+			System: 1,
+			Schema: "aserto.common.info.v1",
+		},
 		Build: Build{
 			Version: "0.0.0",
 			Commit:  "undefined",
@@ -64,4 +103,638 @@ func TestInfoEndpoint(t *testing.T) {
 	}
 
 	assert.Equal(expected, result)
+	assert.Len(result.System.InstanceID, 32)
+	assert.NotEmpty(result.System.CreatedAt)
+}
+
+func TestStartupLogs(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {})
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	// Act
+	resp := h.Get(t, "/api/v1/info", nil)
+
+	// Assert
+	assert.Equal(200, resp.StatusCode)
+	h.AssertLogged(testharness.LogQuery{
+		Level:     "info",
+		Component: "api.go-sample-project",
+		Message:   "GRPC Server starting",
+		Fields:    map[string]interface{}{"address": h.GoSampleProject.Configuration.API.GRPC.ListenAddress},
+	})
+	h.AssertNoErrorLogs()
+}
+
+func TestRuntimeInfoEndpoint(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {
+		cfg.API.Connect.Enabled = true
+	}, testharness.WithInMemory())
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	infoResp, err := info.NewInfoClient(h.GRPCConn(t)).Info(context.Background(), &info.InfoRequest{})
+	assert.NoError(err)
+
+	// Act
+	restResp := &runtimeinfo.RuntimeInfoResponse{}
+	resp := h.Get(t, "/api/v1/info/runtime", restResp)
+
+	grpcResp, err := runtimeinfo.NewRuntimeInfoClient(h.GRPCConn(t)).RuntimeInfo(context.Background(), &runtimeinfo.RuntimeInfoRequest{})
+
+	// Assert
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal(infoResp.System.InstanceId, restResp.InstanceId)
+	assert.NotEmpty(restResp.Hostname)
+	assert.Equal(runtime.Version(), restResp.GoVersion)
+	assert.Regexp("^sha256:[0-9a-f]{64}$", restResp.ConfigHash)
+	assert.Equal([]string{"info"}, restResp.Modules)
+	assert.False(restResp.Features.GrpcWeb)
+	assert.True(restResp.Features.Connect)
+	assert.Contains(restResp.Dependencies, "google.golang.org/grpc")
+	assert.GreaterOrEqual(restResp.UptimeSeconds, 0.0)
+
+	assert.NoError(err)
+	assert.Equal(restResp.ConfigHash, grpcResp.ConfigHash)
+}
+
+func TestInfoEndpointFieldsMask(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {}, testharness.WithInMemory())
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	// Act
+	result := &info.InfoResponse{}
+	resp := h.Get(t, "/api/v1/info?fields.mask=build.version,build.commit", result)
+
+	// Assert
+	assert.Equal(200, resp.StatusCode)
+	assert.True(proto.Equal(&info.InfoResponse{
+		Build: &info.BuildInfo{
+			Version: "0.0.0",
+			Commit:  "undefined",
+		},
+	}, result), "unexpected response %v", result)
+
+	// Act
+	resp = h.Get(t, "/api/v1/info?fields.mask=build.unknown", nil)
+
+	// Assert
+	assert.Equal(400, resp.StatusCode)
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {}, testharness.WithInMemory())
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	// Act
+	resp := h.Get(t, "/api/v1/nothing-here", nil)
+
+	// Assert
+	result := testharness.AssertErrorEnvelope(t, resp, codes.NotFound)
+	assert.NotEmpty(result.RequestID)
+	assert.Equal(resp.Header.Get("X-Request-Id"), result.RequestID)
+	assert.Empty(result.Details)
+
+	// Act
+	req, err := http.NewRequest("GET", h.GatewayURL("/api/v1/info?fields.mask=build.unknown"), http.NoBody)
+	assert.NoError(err)
+	req.Header.Set("X-Request-Id", "test-request")
+	resp, err = h.CreateClient(t).Do(req)
+	assert.NoError(err)
+	defer resp.Body.Close()
+
+	// Assert
+	result = testharness.AssertErrorEnvelope(t, resp, codes.InvalidArgument)
+	assert.Equal("test-request", result.RequestID)
+}
+
+func TestInfoWebSocket(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {}, testharness.WithInMemory())
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	dialer := websocket.Dialer{
+		NetDialContext:  h.DialContext,
+		TLSClientConfig: h.CreateClient(t).Transport.(*http.Transport).TLSClientConfig,
+	}
+
+	// Act
+	conn, resp, err := dialer.Dial("wss://"+h.GatewayAddress+"/api/v1/info?method=GET", nil)
+	assert.NoError(err)
+	defer conn.Close()
+	defer resp.Body.Close()
+
+	_, msg, err := conn.ReadMessage()
+	assert.NoError(err)
+	_, _, err = conn.ReadMessage()
+
+	// Assert
+	assert.True(websocket.IsCloseError(err, websocket.CloseNormalClosure), "%v", err)
+
+	result := map[string]map[string]interface{}{}
+	assert.NoError(json.Unmarshal(msg, &result))
+	assert.Equal("0.0.0", result["build"]["version"])
+}
+
+func TestInfoEventStream(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {}, testharness.WithInMemory())
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	req, err := http.NewRequest("GET", "https://"+h.GatewayAddress+"/api/v1/info", http.NoBody)
+	assert.NoError(err)
+	req.Header.Set("Accept", "text/event-stream")
+
+	// Act
+	resp, err := h.CreateClient(t).Do(req)
+	assert.NoError(err)
+	defer resp.Body.Close()
+
+	events := []string{}
+	data := ""
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: ") && len(events) == 0:
+			data += strings.TrimPrefix(line, "data: ")
+		}
+	}
+
+	// Assert
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal([]string{"end"}, events)
+
+	result := map[string]map[string]interface{}{}
+	assert.NoError(json.Unmarshal([]byte(data), &result))
+	assert.Equal("0.0.0", result["build"]["version"])
+}
+
+// grpcWebMode is a gRPC-Web content type, with the encoding of its bodies.
+type grpcWebMode struct {
+	contentType string
+	encode      func(body []byte) []byte
+	decode      func(t *testing.T, body []byte) []byte
+}
+
+var grpcWebModes = []grpcWebMode{
+	{
+		contentType: "application/grpc-web+proto",
+		encode:      func(body []byte) []byte { return body },
+		decode:      func(_ *testing.T, body []byte) []byte { return body },
+	},
+	{
+		contentType: "application/grpc-web-text+proto",
+		encode: func(body []byte) []byte {
+			return []byte(base64.StdEncoding.EncodeToString(body))
+		},
+		// responses are made of separately padded base64 chunks
+		decode: func(t *testing.T, body []byte) []byte {
+			decoded := []byte{}
+			for i := 0; i+4 <= len(body); i += 4 {
+				quantum, err := base64.StdEncoding.DecodeString(string(body[i : i+4]))
+				require.NoError(t, err)
+				decoded = append(decoded, quantum...)
+			}
+			return decoded
+		},
+	},
+}
+
+func TestInfoGRPCWeb(t *testing.T) {
+	t.Parallel()
+
+	// an empty InfoRequest is a single data frame with no payload
+	emptyFrame := []byte{0, 0, 0, 0, 0}
+
+	listeners := []struct {
+		name     string
+		override func(cfg *config.Config)
+		opts     []testharness.Option
+		address  func(h *testharness.TestHarness) string
+	}{
+		{
+			name: "gateway",
+			override: func(cfg *config.Config) {
+				cfg.API.GRPCWeb.Enabled = true
+			},
+			opts:    []testharness.Option{testharness.WithInMemory()},
+			address: func(h *testharness.TestHarness) string { return h.GatewayAddress },
+		},
+		{
+			// served on TCP, the listener is checked once the server reports that it's ready
+			name: "dedicated",
+			override: func(cfg *config.Config) {
+				cfg.API.GRPCWeb.Enabled = true
+				cfg.API.GRPCWeb.ListenAddress = "127.0.0.1:0"
+			},
+			address: func(h *testharness.TestHarness) string { return h.GRPCWebAddress },
+		},
+	}
+
+	for _, listener := range listeners {
+		for _, mode := range grpcWebModes {
+			listener, mode := listener, mode
+			t.Run(listener.name+" "+mode.contentType, func(t *testing.T) {
+				t.Parallel()
+
+				// Arrange
+				h := testharness.Setup(t, listener.override, listener.opts...)
+				defer h.Cleanup()
+				assert := require.New(t)
+
+				assert.Equal(healthpb.HealthCheckResponse_SERVING, healthStatus(t, h))
+
+				url := "https://" + listener.address(h) + "/aserto.common.info.v1.Info/Info"
+				req, err := http.NewRequest("POST", url, bytes.NewReader(mode.encode(emptyFrame)))
+				assert.NoError(err)
+				req.Header.Set("Content-Type", mode.contentType)
+				req.Header.Set("X-Grpc-Web", "1")
+
+				// Act
+				resp, body := h.RoundTrip(t, req)
+				payload := mode.decode(t, body)
+
+				// Assert
+				assert.Equal(200, resp.StatusCode)
+				assert.Equal(mode.contentType, resp.Header.Get("Content-Type"))
+
+				// data frame followed by the trailers frame
+				assert.Equal(byte(0), payload[0])
+				size := binary.BigEndian.Uint32(payload[1:5])
+				msg := &info.InfoResponse{}
+				assert.NoError(proto.Unmarshal(payload[5:5+size], msg))
+				assert.Equal("0.0.0", msg.Build.Version)
+
+				trailers := payload[5+size:]
+				assert.Equal(byte(0x80), trailers[0])
+				assert.Contains(string(trailers[5:]), "grpc-status: 0")
+			})
+		}
+	}
+}
+
+// healthStatus returns the status of the health service of the application.
+func healthStatus(t *testing.T, h *testharness.TestHarness) healthpb.HealthCheckResponse_ServingStatus {
+	assert := require.New(t)
+
+	conn, err := grpc.Dial(h.HealthAddress,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return h.DialContext(ctx, "tcp", address)
+		}),
+	)
+	assert.NoError(err)
+	defer conn.Close()
+
+	health, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{
+		Service: "grpc.health.v1.go-sample-project",
+	})
+	assert.NoError(err)
+
+	return health.Status
+}
+
+func TestInfoConnect(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {
+		cfg.API.Connect.Enabled = true
+	}, testharness.WithInMemory())
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	protoReq, err := http.NewRequest("POST", h.GatewayURL("/aserto.common.info.v1.Info/Info"), nil)
+	assert.NoError(err)
+	protoReq.Header.Set("Content-Type", "application/proto")
+	protoReq.Header.Set("Connect-Protocol-Version", "1")
+
+	// Act
+	jsonResult := &info.InfoResponse{}
+	jsonResp := h.Post(t, "/aserto.common.info.v1.Info/Info", &info.InfoRequest{}, jsonResult)
+	protoResp, protoBody := h.RoundTrip(t, protoReq)
+	errResp := h.Post(t, "/aserto.common.info.v1.Info/Nope", &info.InfoRequest{}, nil)
+
+	// Assert
+	assert.Equal(200, jsonResp.StatusCode)
+	assert.Equal("application/json", jsonResp.Header.Get("Content-Type"))
+	assert.Equal("0.0.0", jsonResult.Build.Version)
+
+	assert.Equal(200, protoResp.StatusCode)
+	assert.Equal("application/proto", protoResp.Header.Get("Content-Type"))
+	msg := &info.InfoResponse{}
+	assert.NoError(proto.Unmarshal(protoBody, msg))
+	assert.Equal("0.0.0", msg.Build.Version)
+
+	assert.Equal(501, errResp.StatusCode)
+	var connectErr struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	assert.NoError(json.NewDecoder(errResp.Body).Decode(&connectErr))
+	assert.Equal("unimplemented", connectErr.Code)
+}
+
+func TestInfoEndpointRemoteUpstream(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {
+		cfg.API.Gateway.Upstream.Mode = config.UpstreamRemote
+	})
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	// Act
+	var result info.InfoResponse
+	resp := h.Get(t, "/api/v1/info", &result)
+
+	// Assert
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal("0.0.0", result.Build.Version)
+}
+
+// BenchmarkInfoEndpoint compares the latency of REST calls when the gateway
+// dispatches in-process and when it dials the gRPC listener.
+func BenchmarkInfoEndpoint(b *testing.B) {
+	for _, mode := range []string{config.UpstreamInProcess, config.UpstreamRemote} {
+		mode := mode
+		b.Run(mode, func(b *testing.B) {
+			h := testharness.Setup(b, func(cfg *config.Config) {
+				cfg.API.Gateway.Upstream.Mode = mode
+			})
+			defer h.Cleanup()
+			assert := require.New(b)
+			client := h.CreateClient(b)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resp, err := client.Get("https://" + h.GatewayAddress + "/api/v1/info")
+				assert.NoError(err)
+				_, err = io.Copy(io.Discard, resp.Body)
+				assert.NoError(err)
+				resp.Body.Close()
+				assert.Equal(200, resp.StatusCode)
+			}
+			b.StopTimer()
+		})
+	}
+}
+
+func TestGatewayRoleWithoutUpstream(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {
+		cfg.API.Role = config.RoleGateway
+	})
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	// Act
+	client := h.CreateClient(t)
+	resp, err := client.Get("https://" + h.GatewayAddress + "/api/v1/info")
+	assert.NoError(err)
+	defer resp.Body.Close()
+
+	conn, err := grpc.Dial(h.HealthAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(err)
+	defer conn.Close()
+	health, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{
+		Service: "grpc.health.v1.go-sample-project",
+	})
+
+	// Assert
+	assert.False(testutil.PortOpen(h.GRPCAddress))
+	assert.Equal(503, resp.StatusCode)
+	assert.NoError(err)
+	assert.Equal(healthpb.HealthCheckResponse_NOT_SERVING, health.Status)
+}
+
+func TestInfoEndpointBalancedUpstream(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {
+		_, port, err := net.SplitHostPort(cfg.API.GRPC.ListenAddress)
+		require.NoError(t, err)
+		upstream := config.UpstreamConfig{
+			Targets:  []string{net.JoinHostPort("127.0.0.1", port), net.JoinHostPort("localhost", port)},
+			Services: []string{"aserto.common.info.v1.Info"},
+			Balancer: config.BalancerLeastRequest,
+		}
+		upstream.HealthCheck.Enabled = true
+		upstream.HealthCheck.Service = "grpc.health.v1.go-sample-project"
+		cfg.API.Gateway.Upstreams = map[string]config.UpstreamConfig{"info": upstream}
+	})
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	client := h.CreateClient(t)
+	for i := 0; i < 4; i++ {
+		// Act
+		resp, err := client.Get("https://" + h.GatewayAddress + "/api/v1/info")
+		assert.NoError(err)
+		resp.Body.Close()
+
+		// Assert
+		assert.Equal(200, resp.StatusCode)
+	}
+}
+
+func TestInfoGRPC(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {}, testharness.WithInMemory())
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	// Act
+	resp, err := info.NewInfoClient(h.GRPCConn(t)).Info(context.Background(), &info.InfoRequest{})
+
+	// Assert
+	assert.NoError(err)
+	assert.Equal("0.0.0", resp.Build.Version)
+
+	// Act
+	err = h.CreateGRPCConn(t).Invoke(context.Background(), "/aserto.common.info.v1.Info/Unknown", &info.InfoRequest{}, &info.InfoResponse{})
+
+	// Assert
+	testharness.AssertGRPCCode(t, err, codes.Unimplemented)
+}
+
+func TestScenarios(t *testing.T) {
+	testharness.RunScenarios(t, "scenarios/*.yaml")
+}
+
+func TestInfoGolden(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {}, testharness.WithInMemory())
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	// Act
+	resp := h.Get(t, "/api/v1/info", nil)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(err)
+
+	grpcResp, err := info.NewInfoClient(h.GRPCConn(t)).Info(context.Background(), &info.InfoRequest{})
+	assert.NoError(err)
+
+	// Assert
+	assert.Equal(200, resp.StatusCode)
+	testharness.AssertGolden(t, "info.rest", body)
+	testharness.AssertGoldenProto(t, "info.grpc", grpcResp)
+}
+
+func TestIndependentInstances(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	quiet := testharness.Setup(t, func(cfg *config.Config) {
+		cfg.Logging.LogLevel = "error"
+	})
+	defer quiet.Cleanup()
+	verbose := testharness.Setup(t, func(cfg *config.Config) {
+		cfg.Logging.LogLevel = "debug"
+	})
+	defer verbose.Cleanup()
+	assert := require.New(t)
+
+	// Act
+	quietResp := quiet.Get(t, "/api/v1/info", nil)
+	verboseResp := verbose.Get(t, "/api/v1/info", nil)
+
+	// Assert
+	assert.Equal(200, quietResp.StatusCode)
+	assert.Equal(200, verboseResp.StatusCode)
+	assert.NotEqual(quiet.GatewayAddress, verbose.GatewayAddress)
+	quiet.AssertNotLogged(testharness.LogQuery{Level: "info"})
+	verbose.AssertLogged(testharness.LogQuery{Level: "info", Message: "server::Start"})
+}
+
+func TestFailedWorkerHealth(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {})
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	conn, err := grpc.Dial(h.HealthAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	// Act
+	h.GoSampleProject.Server.Supervisor.Go(cc.Worker{
+		Name:    "sync",
+		Restart: cc.RestartNever,
+		Run: func(ctx context.Context) error {
+			return errors.New("sync failed")
+		},
+	})
+
+	// Assert
+	assert.Eventually(func() bool {
+		health, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "worker.sync"})
+		return err == nil && health.Status == healthpb.HealthCheckResponse_NOT_SERVING
+	}, 5*time.Second, 10*time.Millisecond)
+	h.AssertLogged(testharness.LogQuery{Level: "error", Component: "supervisor", Message: "worker failed"})
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {})
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	// Act
+	h.GoSampleProject.Server.Supervisor.Go(cc.Worker{
+		Name:           "flaky",
+		Restart:        cc.RestartOnFailure,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Hour,
+		Run: func(ctx context.Context) error {
+			return errors.New("flaky failed")
+		},
+	})
+
+	// Assert
+	assert.Eventually(func() bool {
+		resp := h.Get(t, "/metrics", nil)
+		body, err := io.ReadAll(resp.Body)
+		return err == nil && resp.StatusCode == http.StatusOK &&
+			strings.Contains(string(body), `supervisor_worker_crash_looping{worker="flaky"} 1`)
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestDisabledModule(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	disabled := false
+	h := testharness.Setup(t, func(cfg *config.Config) {
+		cfg.Modules = map[string]config.ModuleConfig{"info": {Enabled: &disabled}}
+	})
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	// Act
+	resp := h.Get(t, "/api/v1/info", nil)
+	_, err := info.NewInfoClient(h.GRPCConn(t)).Info(context.Background(), &info.InfoRequest{})
+
+	// Assert
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	testharness.AssertGRPCCode(t, err, codes.Unimplemented)
+	h.AssertLogged(testharness.LogQuery{Message: "module disabled", Fields: map[string]interface{}{"module": "info"}})
+}
+
+func TestModuleHealth(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	h := testharness.Setup(t, func(cfg *config.Config) {})
+	defer h.Cleanup()
+	assert := require.New(t)
+
+	conn, err := grpc.Dial(h.HealthAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	// Act & Assert
+	assert.Eventually(func() bool {
+		health, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "module.info"})
+		return err == nil && health.Status == healthpb.HealthCheckResponse_SERVING
+	}, 5*time.Second, 10*time.Millisecond)
 }
@@ -1,33 +1,58 @@
 package app
 
 import (
-	"context"
-
-	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
-	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 
-	info "github.com/aserto-dev/go-grpc/aserto/common/info/v1"
-	"github.com/aserto-dev/go-sample-project/pkg/app/impl"
 	"github.com/aserto-dev/go-sample-project/pkg/app/server"
+	"github.com/aserto-dev/go-sample-project/pkg/module"
+
+	// modules register themselves when their package is imported
+	_ "github.com/aserto-dev/go-sample-project/pkg/app/impl"
 )
 
 // GRPCServerRegistrations is where we register implementations with the GRPC server
-func GRPCServerRegistrations(implInfo *impl.Info) server.Registrations {
-	return func(server *grpc.Server) {
-		info.RegisterInfoServer(server, implInfo)
-	}
+func GRPCServerRegistrations(modules module.Modules) server.Registrations {
+	return modules.Registrations()
 }
 
 // GatewayServerRegistrations is where we register implementations with the Gateway server
-func GatewayServerRegistrations() server.HandlerRegistrations {
-	return func(ctx context.Context, mux *runtime.ServeMux, grpcEndpoint string, opts []grpc.DialOption) error {
+func GatewayServerRegistrations(modules module.Modules) server.HandlerRegistrations {
+	return modules.HandlerRegistrations()
+}
 
-		err := info.RegisterInfoHandlerFromEndpoint(ctx, mux, grpcEndpoint, opts)
-		if err != nil {
-			return errors.Wrap(err, "failed to register info handler with the gateway")
-		}
+// ServerMiddleware is the middleware the modules add to the servers
+func ServerMiddleware(modules module.Modules) server.Middleware {
+	return modules.Middleware()
+}
+
+// ServerHealthChecks are the health checks of the modules
+func ServerHealthChecks(modules module.Modules) server.HealthChecks {
+	return modules.HealthChecks()
+}
 
-		return nil
+// Extensions are added to the servers by programs that embed the service,
+// along with the ones of the modules, see pkg/service.
+type Extensions struct {
+	Registrations        []server.Registrations
+	HandlerRegistrations server.HandlerRegistrations
+	Middleware           server.Middleware
+}
+
+func extendedGRPCServerRegistrations(modules module.Modules, extensions *Extensions) server.Registrations {
+	registrations := modules.Registrations()
+
+	return func(s *grpc.Server) {
+		registrations(s)
+		for _, register := range extensions.Registrations {
+			register(s)
+		}
 	}
 }
+
+func extendedGatewayServerRegistrations(modules module.Modules, extensions *Extensions) server.HandlerRegistrations {
+	return append(modules.HandlerRegistrations(), extensions.HandlerRegistrations...)
+}
+
+func extendedServerMiddleware(modules module.Modules, extensions *Extensions) server.Middleware {
+	return modules.Middleware().Append(extensions.Middleware)
+}
@@ -2,27 +2,65 @@ package impl
 
 import (
 	"context"
-	"runtime"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
 
-	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
-	"github.com/aserto-dev/go-sample-project/pkg/version"
 	info "github.com/aserto-dev/go-grpc/aserto/common/info/v1"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+
+	runtimeinfo "github.com/aserto-dev/go-sample-project/pkg/api/info/v1"
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	"github.com/aserto-dev/go-sample-project/pkg/module"
+	"github.com/aserto-dev/go-sample-project/pkg/version"
 )
 
+const (
+	// apiVersion is the major version of the API served by the application
+	apiVersion = 1
+	// apiSchema is the schema of the info API
+	apiSchema = "aserto.common.info.v1"
+)
+
+// processStarted is when the process started, close enough
+var processStarted = time.Now()
+
 // Info is an implementation of the info API
 type Info struct {
-	logger  *zerolog.Logger
-	cfg     *config.Config
+	logger *zerolog.Logger
+	cfg    *config.Config
+
+	// instanceID identifies the application instance, it changes on every start
+	instanceID string
+	createdAt  time.Time
+	// configHash is the hash of the effective config
+	configHash string
 }
 
 // NewInfo creates a new Info
 func NewInfo(logger *zerolog.Logger, cfg *config.Config) *Info {
 	serviceLogger := logger.With().Str("component", "impl.go Sample Project").Logger()
 
+	instanceID, err := newInstanceID()
+	if err != nil {
+		serviceLogger.Warn().Err(err).Msg("failed to generate instance id")
+	}
+
+	configHash, err := hashConfig(cfg)
+	if err != nil {
+		serviceLogger.Warn().Err(err).Msg("failed to hash config")
+	}
+
 	return &Info{
-		logger:  &serviceLogger,
-		cfg:     cfg,
+		logger:     &serviceLogger,
+		cfg:        cfg,
+		instanceID: instanceID,
+		createdAt:  time.Now(),
+		configHash: configHash,
 	}
 }
 
@@ -30,12 +68,79 @@ func (i *Info) Info(context.Context, *info.InfoRequest) (*info.InfoResponse, err
 	buildVersion := version.GetInfo()
 
 	return &info.InfoResponse{
+		System: &info.SystemInfo{
+			InstanceId: i.instanceID,
+			CreatedAt:  i.createdAt.UTC().Format(time.RFC3339),
+		},
+		Version: &info.VersionInfo{
+			System: apiVersion,
+			Schema: apiSchema,
+		},
 		Build: &info.BuildInfo{
 			Version: buildVersion.Version,
 			Commit:  buildVersion.Commit,
 			Date:    buildVersion.Date,
-			Os:      runtime.GOOS,
-			Arch:    runtime.GOARCH,
+			Os:      buildVersion.OS,
+			Arch:    buildVersion.Arch,
 		},
 	}, nil
 }
+
+// RuntimeInfo returns the details of the running process that the info API doesn't have.
+func (i *Info) RuntimeInfo(context.Context, *runtimeinfo.RuntimeInfoRequest) (*runtimeinfo.RuntimeInfoResponse, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		i.logger.Warn().Err(err).Msg("failed to get hostname")
+	}
+
+	modules := []string{}
+	for _, name := range module.Registered() {
+		if i.cfg.ModuleEnabled(name) {
+			modules = append(modules, name)
+		}
+	}
+
+	buildVersion := version.GetInfo()
+	dependencies := map[string]string{}
+	for _, dep := range buildVersion.Dependencies {
+		dependencies[dep.Path] = dep.Version
+	}
+
+	return &runtimeinfo.RuntimeInfoResponse{
+		InstanceId:    i.instanceID,
+		Hostname:      hostname,
+		StartedAt:     processStarted.UTC().Format(time.RFC3339),
+		UptimeSeconds: time.Since(processStarted).Seconds(),
+		GoVersion:     buildVersion.GoVersion,
+		ConfigHash:    i.configHash,
+		Role:          i.cfg.API.Role,
+		Modules:       modules,
+		Features: &runtimeinfo.Features{
+			GrpcWeb: i.cfg.API.GRPCWeb.Enabled,
+			Connect: i.cfg.API.Connect.Enabled,
+		},
+		Dependencies: dependencies,
+	}, nil
+}
+
+// newInstanceID returns a random identifier.
+func newInstanceID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "failed to read random bytes")
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// hashConfig returns the SHA-256 of the config, as JSON.
+func hashConfig(cfg *config.Config) (string, error) {
+	buf, err := json.Marshal(cfg)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal config")
+	}
+
+	sum := sha256.Sum256(buf)
+
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
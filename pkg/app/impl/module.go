@@ -0,0 +1,45 @@
+package impl
+
+import (
+	info "github.com/aserto-dev/go-grpc/aserto/common/info/v1"
+	"google.golang.org/grpc"
+
+	runtimeinfo "github.com/aserto-dev/go-sample-project/pkg/api/info/v1"
+	"github.com/aserto-dev/go-sample-project/pkg/app/server"
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
+	"github.com/aserto-dev/go-sample-project/pkg/module"
+)
+
+// InfoModuleName is the name of the module that serves the info API
+const InfoModuleName = "info"
+
+func init() {
+	module.Register(InfoModuleName, NewInfoModule)
+}
+
+// InfoModule serves the info and runtime info APIs
+type InfoModule struct {
+	module.Base
+	info *Info
+}
+
+// NewInfoModule creates the info module of an application
+func NewInfoModule(c *cc.CC) (module.Module, error) {
+	return &InfoModule{info: NewInfo(c.Log, c.Config)}, nil
+}
+
+func (m *InfoModule) Name() string {
+	return InfoModuleName
+}
+
+func (m *InfoModule) RegisterGRPC(s *grpc.Server) {
+	info.RegisterInfoServer(s, m.info)
+	runtimeinfo.RegisterRuntimeInfoServer(s, m.info)
+}
+
+func (m *InfoModule) GatewayHandlers() server.HandlerRegistrations {
+	return server.HandlerRegistrations{
+		{Service: info.Info_ServiceDesc.ServiceName, Register: info.RegisterInfoHandler},
+		{Service: runtimeinfo.RuntimeInfo_ServiceDesc.ServiceName, Register: runtimeinfo.RegisterRuntimeInfoHandler},
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"math/rand"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+)
+
+// init makes the custom load balancing policies available to gRPC service
+// configs. gRPC requires balancers to be registered during initialization.
+func init() {
+	balancer.Register(leastRequestBalancerBuilder{})
+}
+
+// leastRequestBalancerBuilder creates balancers that send each RPC to the ready
+// backend with the fewest RPCs in flight.
+type leastRequestBalancerBuilder struct{}
+
+func (leastRequestBalancerBuilder) Name() string {
+	return config.BalancerLeastRequest
+}
+
+// Build creates a picker builder per balancer, so the RPCs in flight are
+// counted per client connection.
+func (leastRequestBalancerBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pickerBuilder := &leastRequestPickerBuilder{inFlight: map[balancer.SubConn]*int64{}}
+
+	return base.NewBalancerBuilder(config.BalancerLeastRequest, pickerBuilder, base.Config{HealthCheck: true}).
+		Build(cc, opts)
+}
+
+// leastRequestPickerBuilder keeps the number of RPCs in flight of each backend,
+// so the counts aren't reset when the picker is rebuilt. The balancer calls
+// Build sequentially.
+type leastRequestPickerBuilder struct {
+	inFlight map[balancer.SubConn]*int64
+}
+
+func (b *leastRequestPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	// the counts of the backends that aren't ready anymore are dropped
+	inFlight := make(map[balancer.SubConn]*int64, len(info.ReadySCs))
+	p := &leastRequestPicker{}
+	for sc := range info.ReadySCs {
+		count, ok := b.inFlight[sc]
+		if !ok {
+			count = new(int64)
+		}
+		inFlight[sc] = count
+		p.subConns = append(p.subConns, &leastRequestSubConn{SubConn: sc, inFlight: count})
+	}
+	b.inFlight = inFlight
+
+	if len(p.subConns) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	return p
+}
+
+type leastRequestSubConn struct {
+	balancer.SubConn
+	inFlight *int64
+}
+
+type leastRequestPicker struct {
+	subConns []*leastRequestSubConn
+}
+
+func (p *leastRequestPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	// start at a random backend, so ties don't always go to the same one
+	offset := rand.Intn(len(p.subConns)) // nolint:gosec // not used for security
+
+	var picked *leastRequestSubConn
+	for i := range p.subConns {
+		sc := p.subConns[(offset+i)%len(p.subConns)]
+		if picked == nil || atomic.LoadInt64(sc.inFlight) < atomic.LoadInt64(picked.inFlight) {
+			picked = sc
+		}
+	}
+
+	atomic.AddInt64(picked.inFlight, 1)
+
+	return balancer.PickResult{
+		SubConn: picked.SubConn,
+		Done: func(balancer.DoneInfo) {
+			atomic.AddInt64(picked.inFlight, -1)
+		},
+	}, nil
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+type fakeSubConn struct {
+	balancer.SubConn
+	name string
+}
+
+func TestLeastRequestCountsAcrossPickers(t *testing.T) {
+	assert := require.New(t)
+
+	a := &fakeSubConn{name: "a"}
+	b := &fakeSubConn{name: "b"}
+	builder := &leastRequestPickerBuilder{inFlight: map[balancer.SubConn]*int64{}}
+
+	// three RPCs in flight on a
+	picker := builder.Build(base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{a: {}}})
+	for i := 0; i < 3; i++ {
+		result, err := picker.Pick(balancer.PickInfo{})
+		assert.NoError(err)
+		assert.Equal(a, result.SubConn)
+	}
+
+	// b becomes ready, it gets the RPCs until it has as many in flight as a
+	picker = builder.Build(base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{a: {}, b: {}}})
+	for i := 0; i < 3; i++ {
+		result, err := picker.Pick(balancer.PickInfo{})
+		assert.NoError(err)
+		assert.Equal(b, result.SubConn)
+	}
+}
@@ -0,0 +1,509 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	connectJSONMIME  = "application/json"
+	connectProtoMIME = "application/proto"
+
+	connectTimeoutHeader   = "Connect-Timeout-Ms"
+	connectTrailerPrefix   = "Trailer-"
+	connectMaxTimeoutChars = 10
+
+	// same as the default maximum message size of the gRPC server
+	connectMaxBodyBytes = 4 * 1024 * 1024
+
+	// http2.TrailerPrefix, used by the gRPC handler transport for trailer metadata
+	grpcTrailerPrefix = "Trailer:"
+)
+
+var (
+	connectJSONUnmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+	// request headers that are specific to Connect or HTTP/1.1,
+	// they are not forwarded to the gRPC server as metadata
+	connectRequestHeaders = []string{
+		"Connection",
+		"Content-Type",
+		"Content-Length",
+		"Content-Encoding",
+		"Accept-Encoding",
+		"Te",
+		"Connect-Protocol-Version",
+		connectTimeoutHeader,
+	}
+
+	// response headers of the gRPC server that are not returned as metadata
+	grpcResponseHeaders = map[string]bool{
+		"Content-Type":            true,
+		"Trailer":                 true,
+		"Grpc-Status":             true,
+		"Grpc-Message":            true,
+		"Grpc-Status-Details-Bin": true,
+		"Grpc-Encoding":           true,
+		"Grpc-Accept-Encoding":    true,
+	}
+)
+
+// connectHandler serves unary RPCs using the Connect protocol, with JSON or
+// binary protobuf bodies.
+// The methods are discovered from the descriptors of the services registered
+// on the gRPC server. Requests are translated to gRPC and handled in-process,
+// so interceptors apply to Connect calls as well.
+type connectHandler struct {
+	logger     *zerolog.Logger
+	grpcServer *grpc.Server
+
+	once    sync.Once
+	methods map[string]connectMethod
+}
+
+type connectMethod struct {
+	input  protoreflect.MessageType
+	output protoreflect.MessageType
+}
+
+func newConnectHandler(log *zerolog.Logger, grpcServer *grpc.Server) *connectHandler {
+	connectLogger := log.With().Str("source", "connect").Logger()
+
+	return &connectHandler{
+		logger:     &connectLogger,
+		grpcServer: grpcServer,
+	}
+}
+
+// accepts returns true for Connect unary requests.
+func (h *connectHandler) accepts(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+
+	_, ok := connectCodec(r)
+	return ok
+}
+
+func (h *connectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.once.Do(h.loadMethods)
+
+	method, ok := h.methods[r.URL.Path]
+	if !ok {
+		h.writeError(w, status.Newf(codes.Unimplemented, "unknown procedure %s", r.URL.Path))
+		return
+	}
+
+	payload, err := h.readRequest(w, r, method)
+	if err != nil {
+		h.writeError(w, status.Convert(err))
+		return
+	}
+
+	ctx := r.Context()
+	if timeout := r.Header.Get(connectTimeoutHeader); timeout != "" {
+		ms, err := strconv.ParseUint(timeout, 10, 64)
+		if err != nil || len(timeout) > connectMaxTimeoutChars {
+			h.writeError(w, status.Newf(codes.InvalidArgument, "invalid %s header %q", connectTimeoutHeader, timeout))
+			return
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+		defer cancel()
+	}
+
+	rec := newGRPCRecorder()
+	h.grpcServer.ServeHTTP(rec, grpcRequest(ctx, r, payload))
+
+	st := rec.status()
+	if st.Code() == codes.Unknown && ctx.Err() != nil {
+		st = status.FromContextError(ctx.Err())
+	}
+
+	copyMetadata(w.Header(), rec.leading, "")
+	copyMetadata(w.Header(), rec.trailers(), connectTrailerPrefix)
+
+	if st.Code() != codes.OK {
+		h.writeError(w, st)
+		return
+	}
+
+	body, err := h.writeResponse(r, method, rec.message())
+	if err != nil {
+		h.writeError(w, status.Convert(err))
+		return
+	}
+
+	contentType, _ := connectCodec(r)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		h.logger.Debug().Err(err).Msg("failed to write connect response")
+	}
+}
+
+// loadMethods indexes the unary methods of all registered services by path.
+// Streaming methods are only available over gRPC.
+func (h *connectHandler) loadMethods() {
+	h.methods = map[string]connectMethod{}
+
+	for service := range h.grpcServer.GetServiceInfo() {
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+		if err != nil {
+			h.logger.Debug().Err(err).Str("service", service).Msg("no descriptor for service, not serving it over connect")
+			continue
+		}
+
+		sd, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			continue
+		}
+
+		for i := 0; i < sd.Methods().Len(); i++ {
+			md := sd.Methods().Get(i)
+			if md.IsStreamingClient() || md.IsStreamingServer() {
+				continue
+			}
+
+			h.methods[fmt.Sprintf("/%s/%s", service, md.Name())] = connectMethod{
+				input:  messageType(md.Input()),
+				output: messageType(md.Output()),
+			}
+		}
+	}
+}
+
+// readRequest returns the request message in the binary protobuf encoding.
+func (h *connectHandler) readRequest(w http.ResponseWriter, r *http.Request, method connectMethod) ([]byte, error) {
+	var body io.Reader = http.MaxBytesReader(w, r.Body, connectMaxBodyBytes)
+
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid gzip body: %s", err)
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, connectMaxBodyBytes+1)
+	default:
+		return nil, status.Errorf(codes.Unimplemented, "unsupported content encoding %q", encoding)
+	}
+
+	buf, err := io.ReadAll(body)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to read request: %s", err)
+	}
+	if len(buf) > connectMaxBodyBytes {
+		return nil, status.Errorf(codes.ResourceExhausted, "request is larger than %d bytes", connectMaxBodyBytes)
+	}
+
+	msg := method.input.New().Interface()
+	if contentType, _ := connectCodec(r); contentType == connectProtoMIME {
+		// the gRPC server would reject it as an internal error
+		if err := proto.Unmarshal(buf, msg); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid request: %s", err)
+		}
+
+		return buf, nil
+	}
+
+	if len(bytes.TrimSpace(buf)) > 0 {
+		if err := connectJSONUnmarshal.Unmarshal(buf, msg); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid request: %s", err)
+		}
+	}
+
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal request")
+	}
+
+	return payload, nil
+}
+
+// writeResponse encodes the response message of the gRPC server as requested by the client.
+func (h *connectHandler) writeResponse(r *http.Request, method connectMethod, payload []byte) ([]byte, error) {
+	if contentType, _ := connectCodec(r); contentType == connectProtoMIME {
+		return payload, nil
+	}
+
+	msg := method.output.New().Interface()
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal response")
+	}
+
+	buf, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+
+	return buf, nil
+}
+
+// connectError is the JSON body of Connect error responses.
+type connectError struct {
+	Code    string               `json:"code"`
+	Message string               `json:"message,omitempty"`
+	Details []connectErrorDetail `json:"details,omitempty"`
+}
+
+type connectErrorDetail struct {
+	Type  string          `json:"type"`
+	Value string          `json:"value"`
+	Debug json.RawMessage `json:"debug,omitempty"`
+}
+
+func (h *connectHandler) writeError(w http.ResponseWriter, st *status.Status) {
+	body := connectError{
+		Code:    connectCode(st.Code()),
+		Message: st.Message(),
+	}
+
+	for _, detail := range st.Proto().GetDetails() {
+		d := connectErrorDetail{
+			Type:  strings.TrimPrefix(detail.GetTypeUrl(), "type.googleapis.com/"),
+			Value: base64.RawStdEncoding.EncodeToString(detail.GetValue()),
+		}
+		if buf, err := protojson.Marshal(detail); err == nil {
+			d.Debug = buf
+		}
+		body.Details = append(body.Details, d)
+	}
+
+	w.Header().Set("Content-Type", connectJSONMIME)
+	w.WriteHeader(connectHTTPStatus(st.Code()))
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.logger.Debug().Err(err).Msg("failed to write connect error")
+	}
+}
+
+// connectCodec returns the content type of a Connect unary request.
+func connectCodec(r *http.Request) (string, bool) {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", false
+	}
+
+	switch contentType {
+	case connectJSONMIME, connectProtoMIME:
+		return contentType, true
+	default:
+		return "", false
+	}
+}
+
+// grpcRequest creates the gRPC request that is handled by the gRPC server.
+func grpcRequest(ctx context.Context, r *http.Request, payload []byte) *http.Request {
+	frame := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	frame = append(frame, payload...)
+
+	req := r.Clone(ctx)
+	for _, h := range connectRequestHeaders {
+		req.Header.Del(h)
+	}
+	for k := range req.Header {
+		if strings.HasPrefix(k, "Grpc-") {
+			req.Header.Del(k)
+		}
+	}
+
+	req.Proto = "HTTP/2"
+	req.ProtoMajor = 2
+	req.ProtoMinor = 0
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("Te", "trailers")
+	req.Body = io.NopCloser(bytes.NewReader(frame))
+	req.ContentLength = int64(len(frame))
+
+	return req
+}
+
+func messageType(md protoreflect.MessageDescriptor) protoreflect.MessageType {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName()); err == nil {
+		return mt
+	}
+
+	return dynamicpb.NewMessageType(md)
+}
+
+func copyMetadata(dst, src http.Header, prefix string) {
+	for k, vs := range src {
+		for _, v := range vs {
+			dst.Add(prefix+k, v)
+		}
+	}
+}
+
+// connectCode returns the Connect name of a gRPC code, e.g. invalid_argument.
+func connectCode(c codes.Code) string {
+	if c == codes.Canceled {
+		// google.rpc.Code uses the British spelling
+		return "canceled"
+	}
+
+	return strings.ToLower(code.Code(c).String())
+}
+
+// connectHTTPStatus maps gRPC codes to HTTP statuses as defined by the Connect protocol.
+func connectHTTPStatus(c codes.Code) int {
+	switch c {
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// grpcRecorder captures the response of the gRPC server.
+// Headers set after WriteHeader are trailers.
+type grpcRecorder struct {
+	header  http.Header
+	leading http.Header
+	code    int
+	body    bytes.Buffer
+}
+
+func newGRPCRecorder() *grpcRecorder {
+	return &grpcRecorder{header: http.Header{}}
+}
+
+func (rec *grpcRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *grpcRecorder) WriteHeader(code int) {
+	if rec.leading != nil {
+		return
+	}
+
+	rec.code = code
+	rec.leading = http.Header{}
+	for k, vs := range rec.header {
+		if !grpcResponseHeaders[k] {
+			rec.leading[k] = append([]string{}, vs...)
+		}
+	}
+}
+
+func (rec *grpcRecorder) Write(p []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(p)
+}
+
+func (rec *grpcRecorder) Flush() {
+	rec.WriteHeader(http.StatusOK)
+}
+
+// trailers returns the trailer metadata, without the gRPC status.
+func (rec *grpcRecorder) trailers() http.Header {
+	trailers := http.Header{}
+	for k, vs := range rec.header {
+		if strings.HasPrefix(k, grpcTrailerPrefix) {
+			trailers[http.CanonicalHeaderKey(strings.TrimPrefix(k, grpcTrailerPrefix))] = vs
+		}
+	}
+
+	return trailers
+}
+
+func (rec *grpcRecorder) status() *status.Status {
+	if rec.code != http.StatusOK {
+		return status.Newf(codes.Internal, "unexpected response from grpc server: %s", strings.TrimSpace(rec.body.String()))
+	}
+
+	value := rec.header.Get("Grpc-Status")
+	if value == "" {
+		return status.New(codes.Unknown, "missing grpc status")
+	}
+
+	c, err := strconv.Atoi(value)
+	if err != nil {
+		return status.Newf(codes.Unknown, "invalid grpc status %q", value)
+	}
+
+	if bin := rec.header.Get("Grpc-Status-Details-Bin"); bin != "" {
+		if buf, err := decodeBinHeader(bin); err == nil {
+			st := &spb.Status{}
+			if err := proto.Unmarshal(buf, st); err == nil {
+				return status.FromProto(st)
+			}
+		}
+	}
+
+	msg := rec.header.Get("Grpc-Message")
+	if unescaped, err := url.PathUnescape(msg); err == nil {
+		msg = unescaped
+	}
+
+	return status.New(codes.Code(c), msg)
+}
+
+// message returns the first message of the response, without the gRPC framing.
+func (rec *grpcRecorder) message() []byte {
+	buf := rec.body.Bytes()
+	if len(buf) < 5 {
+		return nil
+	}
+
+	size := binary.BigEndian.Uint32(buf[1:5])
+	if uint32(len(buf)-5) < size {
+		return nil
+	}
+
+	return buf[5 : 5+size]
+}
+
+func decodeBinHeader(v string) ([]byte, error) {
+	if len(v)%4 == 0 {
+		return base64.StdEncoding.DecodeString(v)
+	}
+
+	return base64.RawStdEncoding.DecodeString(v)
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const connectUnaryCall = "/grpc.testing.TestService/UnaryCall"
+
+// waitPayload makes conformanceServer wait for the request to be done
+const waitPayload = "wait"
+
+// conformanceServer echoes the payload of UnaryCall, returns the status it's
+// asked for, with an ErrorInfo detail, and echoes the x-echo metadata as a
+// header and as a trailer.
+type conformanceServer struct {
+	testpb.UnimplementedTestServiceServer
+	incoming chan metadata.MD
+}
+
+func (s *conformanceServer) UnaryCall(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.incoming <- md
+
+	if echo := md.Get("x-echo"); len(echo) > 0 {
+		_ = grpc.SetHeader(ctx, metadata.Pairs("x-echo", echo[0]))
+		_ = grpc.SetTrailer(ctx, metadata.Pairs("x-echo-trailer", echo[0]))
+	}
+
+	if string(req.GetPayload().GetBody()) == waitPayload {
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+
+	if req.ResponseStatus != nil {
+		st, err := status.New(codes.Code(req.ResponseStatus.Code), req.ResponseStatus.Message).
+			WithDetails(&errdetails.ErrorInfo{Reason: "CONFORMANCE"})
+		if err != nil {
+			return nil, err
+		}
+		return nil, st.Err()
+	}
+
+	return &testpb.SimpleResponse{Payload: req.Payload}, nil
+}
+
+type connectCall struct {
+	path        string
+	contentType string
+	header      http.Header
+	body        []byte
+}
+
+// serveConnect sends a Connect request to a handler backed by conformanceServer.
+func serveConnect(t *testing.T, call connectCall) (*http.Response, []byte, metadata.MD) {
+	log := zerolog.Nop()
+	impl := &conformanceServer{incoming: make(chan metadata.MD, 1)}
+	grpcServer := grpc.NewServer()
+	testpb.RegisterTestServiceServer(grpcServer, impl)
+	handler := newConnectHandler(&log, grpcServer)
+
+	if call.path == "" {
+		call.path = connectUnaryCall
+	}
+	if call.contentType == "" {
+		call.contentType = connectJSONMIME
+	}
+
+	req := httptest.NewRequest(http.MethodPost, call.path, bytes.NewReader(call.body))
+	for k, vs := range call.header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", call.contentType)
+	req.Header.Set("Connect-Protocol-Version", "1")
+	require.True(t, handler.accepts(req))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	resp := rec.Result()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var md metadata.MD
+	select {
+	case md = <-impl.incoming:
+	default:
+	}
+
+	return resp, body, md
+}
+
+func requestJSON(t *testing.T, req *testpb.SimpleRequest) []byte {
+	buf, err := protojson.Marshal(req)
+	require.NoError(t, err)
+
+	return buf
+}
+
+func assertConnectError(t *testing.T, resp *http.Response, body []byte, httpStatus int, code string) connectError {
+	assert := require.New(t)
+
+	assert.Equal(httpStatus, resp.StatusCode)
+	assert.Equal(connectJSONMIME, resp.Header.Get("Content-Type"))
+
+	result := connectError{}
+	assert.NoError(json.Unmarshal(body, &result), "invalid error %s", body)
+	assert.Equal(code, result.Code)
+
+	return result
+}
+
+func TestConnectErrors(t *testing.T) {
+	assert := require.New(t)
+
+	resp, body, _ := serveConnect(t, connectCall{body: requestJSON(t, &testpb.SimpleRequest{
+		ResponseStatus: &testpb.EchoStatus{Code: int32(codes.NotFound), Message: "no such thing"},
+	})})
+	result := assertConnectError(t, resp, body, http.StatusNotFound, "not_found")
+	assert.Equal("no such thing", result.Message)
+	assert.Len(result.Details, 1)
+	assert.Equal("google.rpc.ErrorInfo", result.Details[0].Type)
+
+	value, err := base64.RawStdEncoding.DecodeString(result.Details[0].Value)
+	assert.NoError(err)
+	detail := &errdetails.ErrorInfo{}
+	assert.NoError(proto.Unmarshal(value, detail))
+	assert.Equal("CONFORMANCE", detail.Reason)
+
+	resp, body, _ = serveConnect(t, connectCall{body: requestJSON(t, &testpb.SimpleRequest{
+		ResponseStatus: &testpb.EchoStatus{Code: int32(codes.Canceled)},
+	})})
+	assertConnectError(t, resp, body, 499, "canceled")
+
+	resp, body, _ = serveConnect(t, connectCall{path: "/grpc.testing.TestService/Nope", body: []byte("{}")})
+	assertConnectError(t, resp, body, http.StatusNotImplemented, "unimplemented")
+
+	resp, body, _ = serveConnect(t, connectCall{body: []byte(`{"response_size": "many"}`)})
+	assertConnectError(t, resp, body, http.StatusBadRequest, "invalid_argument")
+
+	resp, body, _ = serveConnect(t, connectCall{contentType: connectProtoMIME, body: []byte{0xff}})
+	assertConnectError(t, resp, body, http.StatusBadRequest, "invalid_argument")
+}
+
+func TestConnectTimeouts(t *testing.T) {
+	waitRequest := requestJSON(t, &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte(waitPayload)}})
+
+	resp, body, _ := serveConnect(t, connectCall{
+		header: http.Header{connectTimeoutHeader: {"10"}},
+		body:   waitRequest,
+	})
+	assertConnectError(t, resp, body, http.StatusGatewayTimeout, "deadline_exceeded")
+
+	resp, body, _ = serveConnect(t, connectCall{
+		header: http.Header{connectTimeoutHeader: {"-1"}},
+		body:   waitRequest,
+	})
+	assertConnectError(t, resp, body, http.StatusBadRequest, "invalid_argument")
+
+	resp, body, _ = serveConnect(t, connectCall{
+		header: http.Header{connectTimeoutHeader: {"12345678901"}},
+		body:   waitRequest,
+	})
+	assertConnectError(t, resp, body, http.StatusBadRequest, "invalid_argument")
+}
+
+func TestConnectCompression(t *testing.T) {
+	assert := require.New(t)
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write(requestJSON(t, &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("zipped")}}))
+	assert.NoError(err)
+	assert.NoError(gz.Close())
+
+	resp, body, _ := serveConnect(t, connectCall{
+		header: http.Header{"Content-Encoding": {"gzip"}, "Accept-Encoding": {"gzip"}},
+		body:   compressed.Bytes(),
+	})
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	// responses are sent uncompressed, which the protocol allows
+	assert.Empty(resp.Header.Get("Content-Encoding"))
+	result := &testpb.SimpleResponse{}
+	assert.NoError(protojson.Unmarshal(body, result))
+	assert.Equal("zipped", string(result.Payload.Body))
+
+	resp, body, _ = serveConnect(t, connectCall{
+		header: http.Header{"Content-Encoding": {"gzip"}},
+		body:   []byte("{}"),
+	})
+	assertConnectError(t, resp, body, http.StatusBadRequest, "invalid_argument")
+
+	resp, body, _ = serveConnect(t, connectCall{
+		header: http.Header{"Content-Encoding": {"br"}},
+		body:   []byte("{}"),
+	})
+	assertConnectError(t, resp, body, http.StatusNotImplemented, "unimplemented")
+}
+
+func TestConnectMetadata(t *testing.T) {
+	assert := require.New(t)
+
+	resp, body, md := serveConnect(t, connectCall{
+		header: http.Header{
+			"X-Echo":             {"hello"},
+			connectTimeoutHeader: {"60000"},
+			"Grpc-Timeout":       {"1n"},
+		},
+		body: requestJSON(t, &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("echo")}}),
+	})
+
+	assert.Equal(http.StatusOK, resp.StatusCode, "%s", body)
+	assert.Equal("hello", resp.Header.Get("X-Echo"))
+	assert.Equal("hello", resp.Header.Get("Trailer-X-Echo-Trailer"))
+	assert.Empty(resp.Header.Get("Grpc-Status"))
+
+	assert.Equal([]string{"hello"}, md.Get("x-echo"))
+	assert.Empty(md.Get("connect-protocol-version"))
+	assert.Empty(md.Get(connectTimeoutHeader))
+
+	resp, body, _ = serveConnect(t, connectCall{
+		contentType: connectProtoMIME,
+		header:      http.Header{"X-Echo": {"binary"}},
+		body:        mustMarshal(t, &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("echo")}}),
+	})
+
+	assert.Equal(http.StatusOK, resp.StatusCode, "%s", body)
+	assert.Equal(connectProtoMIME, resp.Header.Get("Content-Type"))
+	assert.Equal("binary", resp.Header.Get("X-Echo"))
+	result := &testpb.SimpleResponse{}
+	assert.NoError(proto.Unmarshal(body, result))
+	assert.Equal("echo", string(result.Payload.Body))
+}
+
+func mustMarshal(t *testing.T, msg proto.Message) []byte {
+	buf, err := proto.Marshal(msg)
+	require.NoError(t, err)
+
+	return buf
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/aserto-dev/go-sample-project/pkg/apierr"
+)
+
+// errorBody is the JSON envelope returned by the gateway for all errors.
+type errorBody struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	RequestID string            `json:"request_id"`
+	Details   []json.RawMessage `json:"details"`
+}
+
+// errorHandler writes errors as an errorBody, with the HTTP status
+// derived from the gRPC status code.
+func errorHandler(ctx context.Context, mux *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	httpStatus := 0
+
+	var customStatus *runtime.HTTPStatusError
+	if errors.As(err, &customStatus) {
+		err = customStatus.Err
+		httpStatus = customStatus.HTTPStatus
+	}
+
+	st := apierr.Status(err)
+	if httpStatus == 0 {
+		httpStatus = runtime.HTTPStatusFromCode(st.Code())
+	}
+
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for k, vs := range md.HeaderMD {
+			for _, v := range vs {
+				w.Header().Add(fmt.Sprintf("%s%s", runtime.MetadataHeaderPrefix, k), v)
+			}
+		}
+	}
+
+	w.Header().Del("Trailer")
+	w.Header().Del("Transfer-Encoding")
+	w.Header().Set("Content-Type", "application/json")
+
+	if st.Code() == codes.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", st.Message())
+	}
+
+	body := errorBody{
+		Code:      code.Code(st.Code()).String(),
+		Message:   st.Message(),
+		RequestID: r.Header.Get(requestIDHeader),
+		Details:   []json.RawMessage{},
+	}
+
+	for _, detail := range st.Proto().GetDetails() {
+		buf, merr := protojson.Marshal(detail)
+		if merr != nil {
+			zerolog.Ctx(ctx).Debug().Err(merr).Str("type", detail.GetTypeUrl()).Msg("failed to marshal error detail")
+			buf, _ = json.Marshal(map[string]string{"@type": detail.GetTypeUrl()})
+		}
+		body.Details = append(body.Details, buf)
+	}
+
+	w.WriteHeader(httpStatus)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Msg("failed to write error response")
+	}
+}
+
+// routingErrorHandler reports requests that don't match any gateway route
+// using the same envelope as errorHandler.
+func routingErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
+	var err error
+	switch httpStatus {
+	case http.StatusNotFound:
+		err = status.Errorf(codes.NotFound, "no route for %s %s", r.Method, r.URL.Path)
+	case http.StatusMethodNotAllowed:
+		err = status.Errorf(codes.Unimplemented, "method %s not allowed for %s", r.Method, r.URL.Path)
+	case http.StatusBadRequest:
+		err = status.Error(codes.InvalidArgument, http.StatusText(httpStatus))
+	default:
+		err = status.Error(codes.Internal, "unexpected routing error")
+	}
+
+	errorHandler(ctx, mux, marshaler, w, r, &runtime.HTTPStatusError{HTTPStatus: httpStatus, Err: err})
+}
+
+// errorsUnaryInterceptor makes sure that every error returned by a handler
+// carries a gRPC status. Context errors are reported as Canceled or
+// DeadlineExceeded, other bare errors are logged and reported as Internal.
+func errorsUnaryInterceptor(logger *zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		return resp, convertError(logger, info.FullMethod, err)
+	}
+}
+
+// errorsStreamInterceptor is the streaming counterpart of errorsUnaryInterceptor.
+func errorsStreamInterceptor(logger *zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return convertError(logger, info.FullMethod, handler(srv, ss))
+	}
+}
+
+func convertError(logger *zerolog.Logger, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case apierr.HasStatus(err):
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// the client went away or its deadline passed, the handler isn't at fault
+		logger.Debug().Err(err).Str("method", method).Msg("handler returned a context error")
+	default:
+		logger.Error().Err(err).Str("method", method).Msg("handler returned an error without a status")
+	}
+
+	return apierr.Status(err).Err()
+}
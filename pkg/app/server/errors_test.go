@@ -0,0 +1,44 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConvertError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		code  codes.Code
+		level string
+	}{
+		{name: "status", err: status.Error(codes.NotFound, "not found"), code: codes.NotFound},
+		{name: "canceled", err: errors.Wrap(context.Canceled, "failed to read"), code: codes.Canceled, level: "debug"},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, code: codes.DeadlineExceeded, level: "debug"},
+		{name: "bare error", err: errors.New("boom"), code: codes.Internal, level: "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := require.New(t)
+			buf := bytes.Buffer{}
+			logger := zerolog.New(&buf)
+
+			err := convertError(&logger, "/info.v1.Info/Info", tt.err)
+
+			assert.Equal(tt.code, status.Code(err))
+			if tt.level == "" {
+				assert.Empty(buf.String())
+			} else {
+				assert.Contains(buf.String(), `"level":"`+tt.level+`"`)
+			}
+		})
+	}
+}
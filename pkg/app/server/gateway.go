@@ -1,18 +1,27 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 
 	"github.com/aserto-dev/go-utils/certs"
 	"github.com/aserto-dev/go-utils/logger"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
 	"github.com/rs/zerolog"
 	"github.com/slok/go-http-metrics/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	"github.com/aserto-dev/go-sample-project/pkg/fieldmask"
 )
 
 var (
@@ -26,28 +35,84 @@ var (
 		"https://127.0.0.1",
 		"https://127.0.0.1:*",
 	}
+
+	allowedMethods = []string{
+		http.MethodGet,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodDelete,
+		http.MethodHead,
+	}
+
+	allowedHeaders = []string{
+		"Origin",
+		"Accept",
+		"Content-Type",
+		"X-Requested-With",
+		"Authorization",
+		requestIDHeader,
+		// gRPC-Web
+		"X-Grpc-Web",
+		"X-User-Agent",
+		"Grpc-Timeout",
+		// Connect
+		"Connect-Protocol-Version",
+		connectTimeoutHeader,
+	}
+
+	exposedHeaders = []string{
+		requestIDHeader,
+		"Grpc-Status",
+		"Grpc-Message",
+		"Grpc-Status-Details-Bin",
+	}
 )
 
+// metricsPath serves the metrics of the application in the Prometheus format
+const metricsPath = "/metrics"
+
+// requestIDHeader identifies a request in logs and error responses.
+// It's generated by the gateway if the client doesn't send one.
+const requestIDHeader = "X-Request-Id"
+
+// fieldsMaskKey is the context key under which the paths of the fields.mask
+// query parameter are stored.
+type fieldsMaskKey struct{}
+
+// protocolHandler serves the RPC protocols that are mounted next to the
+// gateway routes, like gRPC-Web and Connect.
+type protocolHandler interface {
+	http.Handler
+	accepts(r *http.Request) bool
+}
+
 // newGatewayServer creates a new gateway server.
+// If rpc is not nil, it's served for all paths outside of /api/.
+// The metrics of registry are served on /metrics.
 func newGatewayServer(
 	log *zerolog.Logger,
 	cfg *config.Config,
 	gtwMux *runtime.ServeMux,
+	rpc http.Handler,
 	metricsRecorder metrics.Recorder,
+	metricsRegistry *prometheus.Registry,
+	modules Middleware,
 ) (*http.Server, error) {
-	corsLogger := log.With().Str("source", "cors").Logger()
 	gatewayLogger := log.With().Str("source", "http-gateway").Logger()
 
-	c := cors.New(cors.Options{
-		AllowedOrigins: allowedOrigins,
-		Debug:          cfg.Logging.LogLevelParsed <= zerolog.DebugLevel,
-	})
-	c.Log = &corsLogger
-
+	c := newCORS(log, cfg)
 	middleware := addConfiurableHandler(cfg)
 
+	streaming := newStreamingHandler(log, cfg.API.Gateway.Streaming, c, fieldsMaskResponses(gtwMux))
+
 	mux := http.NewServeMux()
-	mux.Handle("/api/", middleware(fieldsMaskHandler(gtwMux)))
+	mux.Handle("/api/", requestIDHandler(modules.wrap(middleware(fieldsMaskHandler(streaming)))))
+	mux.Handle(metricsPath, promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{
+		ErrorLog: logger.NewSTDLogger(&gatewayLogger),
+	}))
+	if rpc != nil {
+		mux.Handle("/", requestIDHandler(modules.wrap(middleware(rpc))))
+	}
 
 	gtwServer := &http.Server{
 		ErrorLog: logger.NewSTDLogger(&gatewayLogger),
@@ -65,11 +130,29 @@ func newGatewayServer(
 	return gtwServer, nil
 }
 
+// newCORS creates the CORS policy shared by the gateway and gRPC-Web.
+func newCORS(log *zerolog.Logger, cfg *config.Config) *cors.Cors {
+	corsLogger := log.With().Str("source", "cors").Logger()
+
+	c := cors.New(cors.Options{
+		AllowedOrigins: allowedOrigins,
+		AllowedMethods: allowedMethods,
+		AllowedHeaders: allowedHeaders,
+		ExposedHeaders: exposedHeaders,
+		Debug:          cfg.Logging.LogLevelParsed <= zerolog.DebugLevel,
+	})
+	c.Log = &corsLogger
+
+	return c
+}
+
 // customHeaderMatcher is a matcher that makes it so that HTTP clients do not have to prefix
 // the header key with Grpc-Metadata-.
 // see https://grpc-ecosystem.github.io/grpc-gateway/docs/mapping/customizing_your_gateway/#mapping-from-http-request-headers-to-grpc-client-metadata
 func customHeaderMatcher(key string) (string, bool) {
-	switch key { // nolint:gocritic // this is a stub in the cookiecutter, remove this hint after implementing
+	switch http.CanonicalHeaderKey(key) {
+	case requestIDHeader:
+		return "x-request-id", true
 	default:
 		return runtime.DefaultHeaderMatcher(key)
 	}
@@ -78,16 +161,143 @@ func customHeaderMatcher(key string) (string, bool) {
 // fieldsMaskHandler will set the Content-Type to "application/json+masked", which
 // will signal the marshaler to not emit unpopulated types, which is needed to
 // serialize the masked result set.
+// The requested paths are stored in the request context, so fieldsMaskForwarder
+// can project the response.
 // This happens if a fields.mask query parameter is present and set
 func fieldsMaskHandler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if p, ok := r.URL.Query()["fields.mask"]; ok && len(p) > 0 && len(p[0]) > 0 {
+		if paths := fieldmask.Parse(r.URL.Query()["fields.mask"]); len(paths) > 0 {
 			r.Header.Set("Content-Type", "application/json+masked")
+			r = r.WithContext(context.WithValue(r.Context(), fieldsMaskKey{}, paths))
 		}
 		h.ServeHTTP(w, r)
 	})
 }
 
+// fieldsMaskForwarder projects a response on the paths of the fields.mask query
+// parameter. Unknown paths result in an InvalidArgument error.
+// The response can be shared, e.g. by a handler registered with
+// RegisterXHandlerServer that caches it, so a copy is projected and written by
+// the fieldsMaskWriter instead.
+func fieldsMaskForwarder(ctx context.Context, w http.ResponseWriter, resp proto.Message) error {
+	paths, ok := ctx.Value(fieldsMaskKey{}).([]string)
+	if !ok {
+		return nil
+	}
+
+	mw, ok := w.(*fieldsMaskWriter)
+	if !ok {
+		return status.Error(codes.Internal, "fields.mask isn't supported by this route")
+	}
+
+	if resp == nil {
+		// streams are forwarded without a message first
+		mw.streaming = true
+		return nil
+	}
+
+	projected := proto.Clone(resp)
+	if err := fieldmask.Project(projected, paths...); err != nil {
+		return err
+	}
+
+	var body interface{} = projected
+	if rb, ok := projected.(interface{ XXX_ResponseBody() interface{} }); ok {
+		body = rb.XXX_ResponseBody()
+	}
+	if mw.streaming {
+		// the envelope of the messages of streams
+		body = map[string]interface{}{"result": body}
+	}
+
+	buf, err := maskedMarshaler.Marshal(body)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to marshal projected response: %s", err.Error())
+	}
+	mw.projected = buf
+
+	return nil
+}
+
+// fieldsMaskResponses lets fieldsMaskForwarder replace the responses to requests
+// with a fields.mask.
+func fieldsMaskResponses(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(fieldsMaskKey{}).([]string); ok {
+			w = &fieldsMaskWriter{ResponseWriter: w}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// fieldsMaskWriter writes the response projected by fieldsMaskForwarder in place
+// of the one marshaled by the gateway.
+type fieldsMaskWriter struct {
+	http.ResponseWriter
+	// projected replaces the next write
+	projected []byte
+	streaming bool
+}
+
+func (w *fieldsMaskWriter) Write(p []byte) (int, error) {
+	if w.projected == nil {
+		return w.ResponseWriter.Write(p)
+	}
+
+	projected := w.projected
+	w.projected = nil
+	if _, err := w.ResponseWriter.Write(projected); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Flush is required by the gateway to forward streams.
+func (w *fieldsMaskWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// requestIDHandler makes sure every request has an X-Request-Id header, and
+// echoes it back in the response.
+func requestIDHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
+			r.Header.Set(requestIDHeader, requestID)
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// newRPCHandler dispatches requests to the first protocol that accepts them.
+// All other requests are rejected with a 404.
+func newRPCHandler(protocols ...protocolHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range protocols {
+			if p.accepts(r) {
+				p.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		http.NotFound(w, r)
+	})
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(buf)
+}
+
 func addConfiurableHandler(cfg *config.Config) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler { return h }
 }
@@ -96,6 +306,9 @@ func addConfiurableHandler(cfg *config.Config) func(http.Handler) http.Handler {
 func gatewayMux() *runtime.ServeMux {
 	return runtime.NewServeMux(
 		runtime.WithIncomingHeaderMatcher(customHeaderMatcher),
+		runtime.WithForwardResponseOption(fieldsMaskForwarder),
+		runtime.WithErrorHandler(errorHandler),
+		runtime.WithRoutingErrorHandler(routingErrorHandler),
 		runtime.WithMarshalerOption(
 			runtime.MIMEWildcard,
 			&runtime.JSONPb{
@@ -113,22 +326,22 @@ func gatewayMux() *runtime.ServeMux {
 				},
 			},
 		),
-		runtime.WithMarshalerOption(
-			"application/json+masked",
-			&runtime.JSONPb{
-				MarshalOptions: protojson.MarshalOptions{
-					Multiline:       false,
-					Indent:          "  ",
-					AllowPartial:    true,
-					UseProtoNames:   true,
-					UseEnumNumbers:  false,
-					EmitUnpopulated: false,
-				},
-				UnmarshalOptions: protojson.UnmarshalOptions{
-					AllowPartial:   true,
-					DiscardUnknown: false,
-				},
-			},
-		),
+		runtime.WithMarshalerOption("application/json+masked", maskedMarshaler),
 	)
 }
+
+// maskedMarshaler marshals the responses of requests with a fields.mask.
+var maskedMarshaler = &runtime.JSONPb{
+	MarshalOptions: protojson.MarshalOptions{
+		Multiline:       false,
+		Indent:          "  ",
+		AllowPartial:    true,
+		UseProtoNames:   true,
+		UseEnumNumbers:  false,
+		EmitUnpopulated: false,
+	},
+	UnmarshalOptions: protojson.UnmarshalOptions{
+		AllowPartial:   true,
+		DiscardUnknown: false,
+	},
+}
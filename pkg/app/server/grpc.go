@@ -7,7 +7,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"go.opencensus.io/plugin/ocgrpc"
-	"go.opencensus.io/stats/view"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
@@ -15,24 +14,24 @@ import (
 )
 
 // newGRPCServer sets up a new GRPC server
-func newGRPCServer(cfg *config.Config, logger *zerolog.Logger, registrations Registrations) (*grpc.Server, error) {
-	grpc.EnableTracing = true
-
-	if err := view.Register(ocgrpc.DefaultServerViews...); err != nil {
-		logger.Error().Err(err).Msg("failed to register ocgrpc server views")
-	}
-
+func newGRPCServer(cfg *config.Config, logger *zerolog.Logger, registrations Registrations, middleware Middleware) (*grpc.Server, error) {
 	connectionTimeout := time.Duration(cfg.API.GRPC.ConnectionTimeoutSeconds) * time.Second
 	tlsCreds, err := certs.GRPCServerTLSCreds(cfg.API.GRPC.Certs)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to calculate tls config")
 	}
 
+	if cfg.API.Gateway.Upstream.Mode == config.UpstreamInProcess {
+		tlsCreds = &inProcessCreds{TransportCredentials: tlsCreds}
+	}
+
 	tlsAuth := grpc.Creds(tlsCreds)
 	server := grpc.NewServer(
 		tlsAuth,
 		grpc.ConnectionTimeout(connectionTimeout),
 		grpc.StatsHandler(&ocgrpc.ServerHandler{}),
+		grpc.ChainUnaryInterceptor(append([]grpc.UnaryServerInterceptor{errorsUnaryInterceptor(logger)}, middleware.Unary...)...),
+		grpc.ChainStreamInterceptor(append([]grpc.StreamServerInterceptor{errorsStreamInterceptor(logger)}, middleware.Stream...)...),
 	)
 	reflection.Register(server)
 
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/aserto-dev/go-utils/certs"
+	"github.com/aserto-dev/go-utils/logger"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+)
+
+// grpcWebHandler serves gRPC-Web requests, in both binary and text mode,
+// by forwarding them to the gRPC server in-process.
+// CORS is handled by the same policy as the gateway, see newCORS.
+type grpcWebHandler struct {
+	wrapped *grpcweb.WrappedGrpcServer
+}
+
+func newGRPCWebHandler(grpcServer *grpc.Server) *grpcWebHandler {
+	return &grpcWebHandler{wrapped: grpcweb.WrapServer(grpcServer)}
+}
+
+// accepts returns true for gRPC-Web requests.
+func (h *grpcWebHandler) accepts(r *http.Request) bool {
+	return h.wrapped.IsGrpcWebRequest(r)
+}
+
+func (h *grpcWebHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.wrapped.HandleGrpcWebRequest(w, r)
+}
+
+// newGRPCWebServer creates a server for gRPC-Web on its own listener.
+// It uses the certificates of the gateway.
+func newGRPCWebServer(log *zerolog.Logger, cfg *config.Config, grpcWeb protocolHandler, modules Middleware) (*http.Server, error) {
+	grpcWebLogger := log.With().Str("source", "grpc-web").Logger()
+
+	c := newCORS(log, cfg)
+	middleware := addConfiurableHandler(cfg)
+
+	srv := &http.Server{
+		ErrorLog: logger.NewSTDLogger(&grpcWebLogger),
+		Addr:     cfg.API.GRPCWeb.ListenAddress,
+		Handler:  c.Handler(requestIDHandler(modules.wrap(middleware(newRPCHandler(grpcWeb))))),
+	}
+
+	tlsServerConfig, err := certs.GatewayServerTLSConfig(cfg.API.Gateway.Certs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate grpc-web server tls creds")
+	}
+
+	srv.TLSConfig = tlsServerConfig
+
+	return srv, nil
+}
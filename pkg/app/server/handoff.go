@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
+)
+
+const (
+	// handoffFDNamesEnv names the listeners handed off to the new process, in
+	// the order of their file descriptors
+	handoffFDNamesEnv = "GO_SAMPLE_PROJECT_LISTEN_FDNAMES"
+	// handoffReadyFDEnv is the file descriptor of the pipe the new process
+	// reports its readiness on
+	handoffReadyFDEnv = "GO_SAMPLE_PROJECT_READY_FD"
+
+	// handoffFDsStart is the first file descriptor passed to the new process
+	handoffFDsStart = 3
+
+	// handoffTimeout is how long the new process has to become ready
+	handoffTimeout = time.Minute
+	// handoffPollInterval is how often the new process checks its readiness
+	handoffPollInterval = 50 * time.Millisecond
+	// handoffReady is written to the pipe by the new process once it's ready
+	handoffReady = "READY=1"
+)
+
+// openListeners keeps the listeners created by the server, by name, so they
+// can be handed off to a new process.
+type openListeners struct {
+	mu     sync.Mutex
+	byName map[string]net.Listener
+}
+
+func newOpenListeners() *openListeners {
+	return &openListeners{byName: map[string]net.Listener{}}
+}
+
+// track returns Listeners that keep the listeners created by listeners.
+func (o *openListeners) track(listeners Listeners) Listeners {
+	return func(name, address string) (net.Listener, error) {
+		lis, err := listeners(name, address)
+		if err != nil {
+			return nil, err
+		}
+
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.byName[name] = lis
+
+		return lis, nil
+	}
+}
+
+// fds returns the file descriptors of the listeners, sorted by name, and
+// their names. They are valid until the listeners are closed.
+func (o *openListeners) fds() ([]uintptr, []string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	names := make([]string, 0, len(o.byName))
+	for name := range o.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fds := make([]uintptr, 0, len(names))
+	for _, name := range names {
+		conn, ok := o.byName[name].(syscall.Conn)
+		if !ok {
+			return nil, nil, errors.Errorf("listener '%s' can't be handed off", name)
+		}
+
+		raw, err := conn.SyscallConn()
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to get the file descriptor of listener '%s'", name)
+		}
+
+		err = raw.Control(func(fd uintptr) {
+			fds = append(fds, fd)
+		})
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to get the file descriptor of listener '%s'", name)
+		}
+	}
+
+	return fds, names, nil
+}
+
+// Upgrade hands the listeners of the servers off to a new process that runs the
+// executable of this one, usually a newer version of it, with the same arguments.
+// It returns once the new process is ready, and the caller then stops this server,
+// which drains the connections it accepted. If the new process doesn't become ready,
+// or ctx is done first, e.g. because this server is shutting down, it's killed and
+// this server keeps serving.
+func (s *Server) Upgrade(ctx context.Context) error {
+	s.handoffMu.Lock()
+	defer s.handoffMu.Unlock()
+
+	if !handoffSupported {
+		return errors.New("listener handoff isn't supported on this platform")
+	}
+	if s.handedOff {
+		return errors.New("listeners were already handed off")
+	}
+
+	fds, names, err := s.open.fds()
+	if err != nil {
+		return err
+	}
+
+	// the executable is looked up again, the deployment may have replaced it
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return errors.Wrap(err, "failed to find executable")
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return errors.Wrap(err, "failed to create readiness pipe")
+	}
+	defer ready.Close()
+
+	env := append(handoffEnv(),
+		handoffFDNamesEnv+"="+strings.Join(names, ":"),
+		fmt.Sprintf("%s=%d", handoffReadyFDEnv, handoffFDsStart+len(fds)),
+	)
+
+	process, err := startHandoffProcess(path, os.Args, env, append(fds, readyWriter.Fd()))
+	_ = readyWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	log := s.logger.With().Int("pid", process.Pid).Logger()
+	log.Info().Strs("listeners", names).Msg("started new process, waiting for it to be ready")
+
+	if err := waitHandoffReady(ctx, ready, handoffTimeout); err != nil {
+		log.Error().Err(err).Msg("new process isn't ready, stopping it")
+		_ = process.Kill()
+		_, _ = process.Wait()
+
+		return errors.Wrap(err, "new process failed to start")
+	}
+
+	s.handedOff = true
+	_ = process.Release()
+
+	if err := sdNotify(fmt.Sprintf("MAINPID=%d", process.Pid)); err != nil {
+		log.Warn().Err(err).Msg("failed to notify systemd of the new main process")
+	}
+	log.Info().Msg("new process is ready")
+
+	return nil
+}
+
+// handoffEnv returns the environment of this process, without the variables
+// that only apply to it.
+func handoffEnv() []string {
+	env := []string{}
+	for _, v := range os.Environ() {
+		switch strings.SplitN(v, "=", 2)[0] {
+		case "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", "WATCHDOG_PID", handoffFDNamesEnv, handoffReadyFDEnv:
+			continue
+		}
+		env = append(env, v)
+	}
+
+	return env
+}
+
+// waitHandoffReady waits for the new process to write handoffReady to the pipe.
+// The pipe is closed without it if the new process exits.
+func waitHandoffReady(ctx context.Context, ready *os.File, timeout time.Duration) error {
+	if err := ready.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return errors.Wrap(err, "failed to set readiness timeout")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblocks the read
+			_ = ready.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	buf, err := io.ReadAll(ready)
+	if ctx.Err() != nil {
+		return errors.Wrap(ctx.Err(), "stopped waiting for readiness")
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to wait for readiness")
+	}
+
+	if string(buf) != handoffReady {
+		return errors.New("new process exited before it was ready")
+	}
+
+	return nil
+}
+
+// handoffComponent reports the readiness of the server to the process that
+// handed its listeners off.
+func (s *Server) handoffComponent(ready *os.File) cc.Component {
+	return cc.Component{
+		Name:      componentHandoff,
+		DependsOn: []string{componentReadiness},
+		Start: func(context.Context) error {
+			ctx, cancel := context.WithCancel(s.Context)
+			s.handoffCancel = cancel
+
+			s.ErrGroup.Go(func() error {
+				defer ready.Close()
+
+				ticker := time.NewTicker(handoffPollInterval)
+				defer ticker.Stop()
+
+				for !s.serving() {
+					select {
+					case <-ctx.Done():
+						return nil
+					case <-ticker.C:
+					}
+				}
+
+				if _, err := ready.Write([]byte(handoffReady)); err != nil {
+					s.logger.Warn().Err(err).Msg("failed to report readiness to the previous process")
+				}
+
+				return nil
+			})
+
+			return nil
+		},
+		Stop: func(context.Context) error {
+			s.handoffCancel()
+			return nil
+		},
+	}
+}
+
+// isHandedOff returns true if the listeners were handed off to a new process.
+func (s *Server) isHandedOff() bool {
+	s.handoffMu.Lock()
+	defer s.handoffMu.Unlock()
+
+	return s.handedOff
+}
@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package server
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// handoffSupported is true if the listeners can be handed off to a new process
+const handoffSupported = true
+
+// startHandoffProcess runs the executable at path with fds as the file descriptors
+// 3 and up, and the standard streams of this process. Unlike exec.Cmd, it doesn't
+// put the file descriptors into blocking mode, which would also block the
+// listeners of this process.
+func startHandoffProcess(path string, args, env []string, fds []uintptr) (*os.Process, error) {
+	files := append([]uintptr{0, 1, 2}, fds...)
+
+	pid, err := syscall.ForkExec(path, args, &syscall.ProcAttr{Env: env, Files: files})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start new process")
+	}
+
+	return os.FindProcess(pid)
+}
+
+// handoffReadyFile returns the pipe the process that handed its listeners off
+// waits on for the readiness of this process, or nil.
+func handoffReadyFile() *os.File {
+	defer func() {
+		_ = os.Unsetenv(handoffReadyFDEnv)
+	}()
+
+	fd, err := strconv.Atoi(os.Getenv(handoffReadyFDEnv))
+	if err != nil || fd < handoffFDsStart {
+		return nil
+	}
+	syscall.CloseOnExec(fd)
+
+	return os.NewFile(uintptr(fd), "handoff-ready")
+}
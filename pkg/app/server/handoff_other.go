@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// listener handoff is only supported on Linux
+
+const handoffSupported = false
+
+func startHandoffProcess(string, []string, []string, []uintptr) (*os.Process, error) {
+	return nil, errors.New("listener handoff isn't supported on this platform")
+}
+
+func handoffReadyFile() *os.File {
+	return nil
+}
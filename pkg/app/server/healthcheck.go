@@ -1,9 +1,14 @@
 package server
 
 import (
+	"context"
+	"time"
+
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
 )
 
 // HealthServer contains everything we need to be able to serve a health status endpoint
@@ -24,3 +29,61 @@ func newGRPCHealthServer() *HealthServer {
 		GRPCServer: grpcHealthServer,
 	}
 }
+
+// workerServicePrefix prefixes the names of the health services that report
+// the state of the background workers of the supervisor
+const workerServicePrefix = "worker."
+
+// watchWorkers reports supervised workers as serving while they are running,
+// and as not serving while they restart, crash loop or after they failed.
+func (h *HealthServer) watchWorkers(supervisor *cc.Supervisor) {
+	supervisor.Watch(func(name string, state cc.WorkerState) {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if state == cc.WorkerRunning {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+
+		h.Server.SetServingStatus(workerServicePrefix+name, status)
+	})
+}
+
+const (
+	healthCheckInterval = 10 * time.Second
+	healthCheckTimeout  = 5 * time.Second
+)
+
+// HealthCheck reports the health of a part of the application, e.g. a
+// module, as a service of the health server.
+type HealthCheck struct {
+	// Service is the name of the health service
+	Service string
+	// Check returns an error when the service isn't healthy
+	Check func(ctx context.Context) error
+}
+
+// HealthChecks are run periodically while the server is running.
+type HealthChecks []HealthCheck
+
+// run checks the health of the service until ctx is done.
+func (c *HealthCheck) run(ctx context.Context, h *HealthServer) error {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		err := c.Check(checkCtx)
+		cancel()
+
+		status := healthpb.HealthCheckResponse_SERVING
+		if err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		h.Server.SetServingStatus(c.Service, status)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
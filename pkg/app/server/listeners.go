@@ -0,0 +1,24 @@
+package server
+
+import (
+	"net"
+)
+
+// Names of the listeners created by the server.
+const (
+	ListenerHealth  = "health"
+	ListenerGRPC    = "grpc"
+	ListenerGateway = "gateway"
+	ListenerGRPCWeb = "grpc-web"
+)
+
+// Listeners creates the listener of a server, name is one of the Listener* constants
+// and address is the configured listen address.
+type Listeners func(name, address string) (net.Listener, error)
+
+// TCPListeners listens on the configured TCP addresses.
+func TCPListeners() Listeners {
+	return func(_, address string) (net.Listener, error) {
+		return net.Listen("tcp", address)
+	}
+}
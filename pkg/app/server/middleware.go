@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc"
+)
+
+// Middleware is added to the servers by modules. The errors interceptor and
+// the request ID handler of the server wrap it.
+type Middleware struct {
+	// Unary and Stream intercept the calls of the gRPC server
+	Unary  []grpc.UnaryServerInterceptor
+	Stream []grpc.StreamServerInterceptor
+	// HTTP wraps the handlers of the gateway and gRPC-Web servers, the first one is the outermost
+	HTTP []func(http.Handler) http.Handler
+}
+
+// Append adds the middleware of other after the middleware of m.
+func (m Middleware) Append(other Middleware) Middleware {
+	return Middleware{
+		Unary:  append(append([]grpc.UnaryServerInterceptor{}, m.Unary...), other.Unary...),
+		Stream: append(append([]grpc.StreamServerInterceptor{}, m.Stream...), other.Stream...),
+		HTTP:   append(append([]func(http.Handler) http.Handler{}, m.HTTP...), other.HTTP...),
+	}
+}
+
+// wrap applies the HTTP middleware to h.
+func (m Middleware) wrap(h http.Handler) http.Handler {
+	for i := len(m.HTTP) - 1; i >= 0; i-- {
+		h = m.HTTP[i](h)
+	}
+
+	return h
+}
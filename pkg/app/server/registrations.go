@@ -10,5 +10,15 @@ import (
 // Registrations represents a function that can register API implementations to the GRPC server.
 type Registrations func(server *grpc.Server)
 
-// HandlerRegistrations represents a function that can register handlers for the Gateway.
-type HandlerRegistrations func(ctx context.Context, mux *runtime.ServeMux, grpcEndpoint string, opts []grpc.DialOption) error
+// HandlerRegistration registers the Gateway handlers of a gRPC service.
+type HandlerRegistration struct {
+	// Service is the fully qualified name of the gRPC service, it selects the upstream
+	// the handlers forward requests to.
+	Service string
+	// Register registers the handlers with mux. Requests are forwarded using conn,
+	// which is owned by the server.
+	Register func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+}
+
+// HandlerRegistrations represents the services that have handlers for the Gateway.
+type HandlerRegistrations []HandlerRegistration
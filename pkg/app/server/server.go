@@ -3,35 +3,79 @@ package server
 import (
 	"context"
 	"fmt"
-	"net"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 
-	"github.com/aserto-dev/go-utils/certs"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
 
 	"github.com/aserto-dev/go-sample-project/pkg/cc"
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
 )
 
 const (
 	svcName = "go-sample-project"
+
+	// healthServiceName reports whether the server is ready to serve requests
+	healthServiceName = "grpc.health.v1." + svcName
+)
+
+// Names of the components the server registers with the lifecycle of the application
+const (
+	componentHealth          = "health"
+	componentGRPC            = "grpc"
+	componentGateway         = "gateway"
+	componentGRPCWeb         = "grpc-web"
+	componentHealthChecks    = "health-checks"
+	componentReadiness       = "readiness"
+	componentSystemd         = "systemd"
+	componentHandoff         = "handoff"
+	componentUnusedListeners = "unused-listeners"
 )
 
 // Server manages the GRPC and HTTP servers, as well as their health servers.
 type Server struct {
 	*cc.CC
-	logger       *zerolog.Logger
-	grpcServer   *grpc.Server
-	gtwServer    *http.Server
-	healthServer *HealthServer
-	gtwMux       *runtime.ServeMux
+	logger        *zerolog.Logger
+	grpcServer    *grpc.Server
+	gtwServer     *http.Server
+	grpcWebServer *http.Server
+	healthServer  *HealthServer
+	gtwMux        *runtime.ServeMux
+	// gtwConns are the connections to the upstreams of the gateway, by name
+	gtwConns map[string]*grpc.ClientConn
+
+	// stops following the health of a remote upstream
+	upstreamCancel context.CancelFunc
+
+	// inProcessListener serves the gRPC server to the gateway in memory
+	inProcessListener *bufconn.Listener
 
 	handlerRegistrations HandlerRegistrations
+	listeners            Listeners
+	healthChecks         HealthChecks
+	// stops running the health checks
+	healthChecksCancel context.CancelFunc
+	// stops notifying systemd
+	systemdCancel context.CancelFunc
+
+	// open are the listeners of the servers, for Upgrade
+	open *openListeners
+	// handoffReady is the pipe of the process that handed its listeners off
+	// to this one, if any
+	handoffReady *os.File
+	// stops reporting the readiness to the process that handed its listeners off
+	handoffCancel context.CancelFunc
+	handoffMu     sync.Mutex
+	// handedOff is true once the listeners were handed off to a new process
+	handedOff bool
 }
 
 // NewServer sets up a new server
@@ -39,30 +83,90 @@ func NewServer(
 	c *cc.CC,
 	registrations Registrations,
 	handlerRegistrations HandlerRegistrations,
+	listeners Listeners,
+	middleware Middleware,
+	healthChecks HealthChecks,
 ) (*Server, func(), error) {
 	newLogger := c.Log.With().Str("component", fmt.Sprintf("api.%s", svcName)).Logger()
 
-	grpcServer, err := newGRPCServer(c.Config, &newLogger, registrations)
+	role := c.Config.API.Role
+
+	healthServer := newGRPCHealthServer()
+	healthServer.watchWorkers(c.Supervisor)
+
+	grpcServer, err := newGRPCServer(c.Config, &newLogger, registrations, middleware)
 	if err != nil {
 		return nil, nil, err
 	}
+	// lets clients, like a gateway running in another process, check the health of their upstream
+	healthpb.RegisterHealthServer(grpcServer, healthServer.Server)
+
+	var (
+		protocols     []protocolHandler
+		grpcWebServer *http.Server
+	)
+	// gRPC-Web and Connect are served by the gRPC server in-process
+	if role != config.RoleGateway {
+		if c.Config.API.GRPCWeb.Enabled {
+			grpcWeb := newGRPCWebHandler(grpcServer)
+
+			if c.Config.API.GRPCWeb.ListenAddress != "" {
+				grpcWebServer, err = newGRPCWebServer(&newLogger, c.Config, grpcWeb, middleware)
+				if err != nil {
+					return nil, nil, err
+				}
+			} else {
+				protocols = append(protocols, grpcWeb)
+			}
+		}
 
-	gtwMux := gatewayMux()
-	gtwServer, err := newGatewayServer(&newLogger, c.Config, gtwMux, c.MetricsRecorder)
-	if err != nil {
-		return nil, nil, err
+		if c.Config.API.Connect.Enabled {
+			protocols = append(protocols, newConnectHandler(&newLogger, grpcServer))
+		}
 	}
 
-	healthServer := newGRPCHealthServer()
+	var rpc http.Handler
+	if len(protocols) > 0 {
+		rpc = newRPCHandler(protocols...)
+	}
+
+	var (
+		gtwMux            *runtime.ServeMux
+		gtwServer         *http.Server
+		inProcessListener *bufconn.Listener
+	)
+	if role != config.RoleGRPC {
+		gtwMux = gatewayMux()
+		gtwServer, err = newGatewayServer(&newLogger, c.Config, gtwMux, rpc, c.MetricsRecorder, c.MetricsRegistry, middleware)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if c.Config.API.Gateway.Upstream.Mode == config.UpstreamInProcess {
+			inProcessListener = bufconn.Listen(inProcessBufferSize)
+		}
+	}
+
+	open := newOpenListeners()
 
 	server := &Server{
 		CC:                   c,
 		logger:               &newLogger,
 		grpcServer:           grpcServer,
 		gtwServer:            gtwServer,
+		grpcWebServer:        grpcWebServer,
 		gtwMux:               gtwMux,
 		healthServer:         healthServer,
 		handlerRegistrations: handlerRegistrations,
+		inProcessListener:    inProcessListener,
+		listeners:            open.track(listeners),
+		healthChecks:         healthChecks,
+		open:                 open,
+		handoffReady:         handoffReadyFile(),
+	}
+
+	if err := server.registerComponents(); err != nil {
+		return nil, nil, err
 	}
 
 	return server, func() {
@@ -74,93 +178,267 @@ func NewServer(
 }
 
 // Start starts the GRPC and HTTP servers, as well as their health servers.
+// If one of them fails to start, the ones that were already started are stopped.
 func (s *Server) Start() error {
 	s.logger.Info().Msg("server::Start")
 
-	grpc.EnableTracing = true
+	return s.Lifecycle.Start(s.Context)
+}
+
+// Stop stops the GRPC and HTTP servers, as well as their health servers.
+// It can be called more than once, only the first call stops them.
+func (s *Server) Stop() error {
+	result := s.Lifecycle.Stop(s.Context)
+
+	err := s.ErrGroup.Wait()
+	if err != nil {
+		s.logger.Info().Err(err).Msg("shutdown complete")
+	}
+
+	return result
+}
+
+// registerComponents adds the servers to the lifecycle of the application.
+// The readiness component comes last, the application is ready once all
+// servers are listening.
+func (s *Server) registerComponents() error {
+	components := []cc.Component{{
+		Name: componentHealth,
+		Start: func(context.Context) error {
+			return errors.Wrap(s.startHealthService(s.Config.API.Health.ListenAddress), "failed to start health server")
+		},
+		Stop: func(context.Context) error {
+			s.healthServer.GRPCServer.GracefulStop()
+			return nil
+		},
+	}}
+	ready := []string{componentHealth}
+
+	if len(s.healthChecks) > 0 {
+		components = append(components, cc.Component{
+			Name:      componentHealthChecks,
+			DependsOn: []string{componentHealth},
+			Start: func(context.Context) error {
+				s.startHealthChecks()
+				return nil
+			},
+			Stop: func(context.Context) error {
+				s.healthChecksCancel()
+				return nil
+			},
+		})
+	}
+
+	if s.Config.API.Role != config.RoleGateway {
+		components = append(components, cc.Component{
+			Name: componentGRPC,
+			Start: func(context.Context) error {
+				return errors.Wrap(s.startGRPCServer(s.Config.API.GRPC.ListenAddress), "failed to start grpc server")
+			},
+			Stop: func(context.Context) error {
+				s.grpcServer.GracefulStop()
+				return nil
+			},
+		})
+		ready = append(ready, componentGRPC)
+	}
 
-	if err := s.startHealthService(s.Config.API.Health.ListenAddress); err != nil {
-		return errors.Wrap(err, "failed to start health server")
+	// the gateway and gRPC-Web servers call the gRPC server in-process
+	var grpcDependency []string
+	if s.Config.API.Role == config.RoleAll {
+		grpcDependency = []string{componentGRPC}
 	}
 
-	if err := s.startGRPCServer(s.Config.API.GRPC.ListenAddress); err != nil {
-		return errors.Wrap(err, "failed to start grpc server")
+	if s.gtwServer != nil {
+		components = append(components, cc.Component{
+			Name:      componentGateway,
+			DependsOn: grpcDependency,
+			Start: func(context.Context) error {
+				return errors.Wrap(s.startGatewayServer(s.Config.API.Gateway.ListenAddress), "failed to start gateway server")
+			},
+			Stop: s.stopGatewayServer,
+		})
+		ready = append(ready, componentGateway)
 	}
 
-	if err := s.startGatewayServer(s.Config.API.Gateway.ListenAddress); err != nil {
-		return errors.Wrap(err, "failed to start gateway server")
+	if s.grpcWebServer != nil {
+		components = append(components, cc.Component{
+			Name:      componentGRPCWeb,
+			DependsOn: grpcDependency,
+			Start: func(context.Context) error {
+				return errors.Wrap(s.startGRPCWebServer(s.Config.API.GRPCWeb.ListenAddress), "failed to start grpc-web server")
+			},
+			Stop: func(ctx context.Context) error {
+				return errors.Wrap(s.stopHTTPServer(ctx, s.grpcWebServer), "failed to stop grpc-web server")
+			},
+		})
+		ready = append(ready, componentGRPCWeb)
 	}
 
-	s.healthServer.Server.SetServingStatus(fmt.Sprintf("grpc.health.v1.%s", svcName), healthpb.HealthCheckResponse_SERVING)
+	components = append(components, cc.Component{
+		Name:      componentReadiness,
+		DependsOn: ready,
+		Start: func(context.Context) error {
+			s.startReadiness()
+			return nil
+		},
+		Stop: func(context.Context) error {
+			s.logger.Info().Msg("Server stopping.")
+
+			if s.upstreamCancel != nil {
+				s.upstreamCancel()
+			}
+			s.healthServer.Server.SetServingStatus(healthServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+
+			return nil
+		},
+	})
+
+	if systemdNotifyEnabled() {
+		components = append(components, s.systemdComponent())
+	}
+
+	if s.handoffReady != nil {
+		components = append(components, s.handoffComponent(s.handoffReady))
+	}
+
+	for _, component := range components {
+		if err := s.Lifecycle.Register(component); err != nil {
+			return errors.Wrap(err, "failed to register server component")
+		}
+	}
 
 	return nil
 }
 
-// Stop stops the GRPC and HTTP servers, as well as their health servers.
-func (s *Server) Stop() error {
-	var result error
+// startReadiness reports that the server is ready, or for gateways, starts
+// following the health of their upstreams.
+func (s *Server) startReadiness() {
+	if s.Config.API.Role != config.RoleGateway {
+		s.healthServer.Server.SetServingStatus(healthServiceName, healthpb.HealthCheckResponse_SERVING)
+		return
+	}
 
-	s.logger.Info().Msg("Server stopping.")
+	// the gateway is ready when its upstream is
+	s.healthServer.Server.SetServingStatus(healthServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
 
-	if s.gtwServer != nil {
-		err := s.stopHTTPServer(s.gtwServer)
-		if err != nil {
-			result = multierror.Append(result, errors.Wrap(err, "failed to stop gateway server"))
-		}
+	ctx, cancel := context.WithCancel(s.Context)
+	s.upstreamCancel = cancel
+
+	upstreams := newUpstreamsHealth(s.healthServer.Server)
+	for name := range s.gtwConns {
+		upstreams.set(name, false)
 	}
 
-	if s.healthServer != nil {
-		s.healthServer.Server.SetServingStatus(
-			fmt.Sprintf("grpc.health.v1.%s", svcName),
-			healthpb.HealthCheckResponse_NOT_SERVING,
-		)
+	for name, conn := range s.gtwConns {
+		name, conn := name, conn
+		service := s.Config.Upstream(name).HealthCheck.Service
+		s.ErrGroup.Go(func() error {
+			upstreams.watch(ctx, s.logger, name, service, conn)
+			return nil
+		})
 	}
+}
 
-	if s.grpcServer != nil {
-		s.grpcServer.GracefulStop()
+// startHealthChecks runs every health check in a worker of the supervisor.
+func (s *Server) startHealthChecks() {
+	ctx, cancel := context.WithCancel(s.Context)
+	s.healthChecksCancel = cancel
+
+	for i := range s.healthChecks {
+		check := &s.healthChecks[i]
+		s.Supervisor.Go(cc.Worker{
+			Name:    "health-check." + check.Service,
+			Restart: cc.RestartOnFailure,
+			Run: func(workerCtx context.Context) error {
+				// the check stops with the server, or with the supervisor
+				checkCtx, checkCancel := context.WithCancel(ctx)
+				defer checkCancel()
+				go func() {
+					select {
+					case <-workerCtx.Done():
+						checkCancel()
+					case <-checkCtx.Done():
+					}
+				}()
+
+				return check.run(checkCtx, s.healthServer)
+			},
+		})
 	}
+}
+
+func (s *Server) stopGatewayServer(ctx context.Context) error {
+	var result error
 
-	if s.healthServer.GRPCServer != nil {
-		s.healthServer.GRPCServer.GracefulStop()
+	if err := s.stopHTTPServer(ctx, s.gtwServer); err != nil {
+		result = multierror.Append(result, errors.Wrap(err, "failed to stop gateway server"))
 	}
 
-	err := s.ErrGroup.Wait()
-	if err != nil {
-		s.logger.Info().Err(err).Msg("shutdown complete")
+	if err := s.closeGatewayConns(); err != nil {
+		result = multierror.Append(result, err)
 	}
 
 	return result
 }
 
-func (s *Server) registerGateway() error {
-	_, port, err := net.SplitHostPort(s.Config.API.GRPC.ListenAddress)
-	if err != nil {
-		return errors.Wrap(err, "failed to determine port from configured GRPC listen address")
+// closeGatewayConns closes the connections to the upstreams of the gateway.
+func (s *Server) closeGatewayConns() error {
+	var result error
+
+	for name, conn := range s.gtwConns {
+		err := conn.Close()
+		if err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "failed to close connection to gateway upstream '%s'", name))
+		}
 	}
+	s.gtwConns = nil
 
-	dialAddr := fmt.Sprintf("dns:///127.0.0.1:%s", port)
+	return result
+}
 
-	tlsCreds, err := certs.GatewayAsClientTLSCreds(s.Config.API.GRPC.Certs)
-	if err != nil {
-		return errors.Wrap(err, "failed to calculate tls config for gateway service")
+func (s *Server) registerGateway() error {
+	routes := map[string]string{}
+	for name, upstream := range s.Config.API.Gateway.Upstreams {
+		for _, service := range upstream.Services {
+			routes[service] = name
+		}
 	}
 
-	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(tlsCreds),
-		grpc.WithBlock(),
-		grpc.WithTimeout(2 * time.Second), // nolint:staticcheck // using context.WithTimeout makes us unable to call defer ctx.Cancel
+	s.gtwConns = map[string]*grpc.ClientConn{}
+	registered := map[string]bool{}
+
+	for _, registration := range s.handlerRegistrations {
+		name := routes[registration.Service]
+
+		conn, ok := s.gtwConns[name]
+		if !ok {
+			var err error
+			conn, err = dialUpstream(s.Context, s.Config, name, s.inProcessListener)
+			if err != nil {
+				return errors.Wrap(err, "failed to connect gateway to grpc upstream")
+			}
+			s.gtwConns[name] = conn
+		}
+
+		err := registration.Register(s.Context, s.gtwMux, conn)
+		if err != nil {
+			return errors.Wrapf(err, "failed to register handlers of %s with the gateway", registration.Service)
+		}
+		registered[registration.Service] = true
 	}
 
-	err = s.handlerRegistrations(s.Context, s.gtwMux, dialAddr, opts)
-	if err != nil {
-		return errors.Wrap(err, "failed to register handlers with the gateway")
+	for service, name := range routes {
+		if !registered[service] {
+			s.logger.Warn().Str("service", service).Str("upstream", name).Msg("no gateway handlers registered for service")
+		}
 	}
 
 	return nil
 }
 
 func (s *Server) startHealthService(listenAddress string) error {
-	healthListener, err := net.Listen("tcp", listenAddress)
+	healthListener, err := s.listeners(ListenerHealth, listenAddress)
 	if err != nil {
 		s.logger.Error().Err(err).Str("address", listenAddress).Msg("grpc health socket failed to listen")
 		return errors.Wrap(err, "grpc health socket failed to listen")
@@ -176,7 +454,7 @@ func (s *Server) startHealthService(listenAddress string) error {
 
 func (s *Server) startGRPCServer(listenAddress string) error {
 	s.logger.Info().Str("address", listenAddress).Msg("GRPC Server starting")
-	grpcListener, err := net.Listen("tcp", listenAddress)
+	grpcListener, err := s.listeners(ListenerGRPC, listenAddress)
 	if err != nil {
 		return errors.Wrap(err, "grpc socket failed to listen")
 	}
@@ -189,37 +467,68 @@ func (s *Server) startGRPCServer(listenAddress string) error {
 		return errors.Wrap(err, "grpc server failed to listen")
 	})
 
+	if s.inProcessListener != nil {
+		s.ErrGroup.Go(func() error {
+			return errors.Wrap(s.grpcServer.Serve(inProcessListener{s.inProcessListener}), "in-process grpc server failed")
+		})
+	}
+
 	return nil
 }
 
+// startGatewayServer connects the gateway to its upstreams and starts serving it.
+// The lifecycle only stops started components, so the connections are closed
+// here if the gateway fails to start.
 func (s *Server) startGatewayServer(listenAddress string) error {
 	s.logger.Info().Msg("Registering OpenAPI Gateway handlers")
 	if err := s.registerGateway(); err != nil {
+		_ = s.closeGatewayConns()
 		return errors.Wrap(err, "failed to register grpc gateway handlers")
 	}
 
+	gtwListener, err := s.listeners(ListenerGateway, listenAddress)
+	if err != nil {
+		_ = s.closeGatewayConns()
+		return errors.Wrap(err, "gateway socket failed to listen")
+	}
+
 	s.logger.Info().
 		Str("address", "https://"+listenAddress).
 		Msg("gRPC-Gateway and OpenAPI endpoint starting")
 	s.ErrGroup.Go(func() error {
-		return s.gtwServer.ListenAndServeTLS("", "")
+		return s.gtwServer.ServeTLS(gtwListener, "", "")
 	})
 
 	return nil
 }
 
-func (s *Server) stopHTTPServer(srv *http.Server) error {
-	ctx, shutdownCancel := context.WithTimeout(s.Context, 5*time.Second)
+func (s *Server) startGRPCWebServer(listenAddress string) error {
+	grpcWebListener, err := s.listeners(ListenerGRPCWeb, listenAddress)
+	if err != nil {
+		return errors.Wrap(err, "grpc-web socket failed to listen")
+	}
+
+	s.logger.Info().
+		Str("address", "https://"+listenAddress).
+		Msg("gRPC-Web endpoint starting")
+	s.ErrGroup.Go(func() error {
+		return s.grpcWebServer.ServeTLS(grpcWebListener, "", "")
+	})
+
+	return nil
+}
+
+// stopHTTPServer drains the connections of srv. The server context is already
+// canceled when the server stops, so draining has its own timeout.
+func (s *Server) stopHTTPServer(_ context.Context, srv *http.Server) error {
+	ctx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
 
 	err := srv.Shutdown(ctx)
-	if err != nil {
-		if err == context.Canceled {
-			s.logger.Info().Msg("server context was canceled - shutting down")
-		} else {
-			return err
-		}
+	if err == context.DeadlineExceeded {
+		s.logger.Warn().Msg("connections weren't drained in time - closing them")
+		return srv.Close()
 	}
 
-	return nil
+	return err
 }
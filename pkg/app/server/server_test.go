@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGatewayStartFailureClosesConnections(t *testing.T) {
+	assert := require.New(t)
+
+	log := zerolog.Nop()
+	cfg := &config.Config{}
+	cfg.API.Gateway.Upstream.Mode = config.UpstreamInProcess
+
+	var conn *grpc.ClientConn
+	s := &Server{
+		CC:                &cc.CC{Context: context.Background(), Config: cfg, Log: &log},
+		logger:            &log,
+		gtwMux:            runtime.NewServeMux(),
+		inProcessListener: bufconn.Listen(1024),
+		handlerRegistrations: HandlerRegistrations{{
+			Service: "info.v1.Info",
+			Register: func(_ context.Context, _ *runtime.ServeMux, c *grpc.ClientConn) error {
+				conn = c
+				return nil
+			},
+		}},
+		listeners: func(string, string) (net.Listener, error) {
+			return nil, errors.New("address in use")
+		},
+	}
+
+	err := s.startGatewayServer("127.0.0.1:0")
+
+	assert.Error(err)
+	assert.NotNil(conn)
+	assert.Equal(connectivity.Shutdown, conn.GetState())
+	assert.Nil(s.gtwConns)
+}
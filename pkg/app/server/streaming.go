@@ -0,0 +1,417 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/cors"
+	"github.com/rs/zerolog"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+)
+
+const (
+	// methodQueryParam overrides the HTTP method used to route a streaming request,
+	// because browsers can only use GET for WebSockets and EventSource.
+	methodQueryParam = "method"
+	// bodyQueryParam holds the request message of an SSE request.
+	bodyQueryParam = "body"
+	// accessTokenQueryParam is passed as a bearer token in the Authorization header,
+	// because browsers can't set headers for WebSockets and EventSource.
+	accessTokenQueryParam = "access_token"
+
+	eventStreamMIME = "text/event-stream"
+	writeTimeout    = 10 * time.Second
+)
+
+var (
+	streamDelimiter = []byte("\n")
+
+	webSocketHeaders = []string{
+		"Connection",
+		"Upgrade",
+		"Sec-Websocket-Key",
+		"Sec-Websocket-Version",
+		"Sec-Websocket-Extensions",
+		"Sec-Websocket-Protocol",
+	}
+)
+
+// streamingHandler exposes the routes of the gateway over WebSockets and
+// Server-Sent Events. Each message written by the gateway (newline delimited
+// JSON for streaming RPCs) is sent as a WebSocket message or an SSE event.
+// Messages received over a WebSocket are forwarded as the request body, so
+// client and bidi streaming RPCs work as well.
+type streamingHandler struct {
+	logger   *zerolog.Logger
+	cfg      config.StreamingConfig
+	upgrader websocket.Upgrader
+	next     http.Handler
+}
+
+// newStreamingHandler wraps the gateway handler. Plain HTTP requests are passed through.
+func newStreamingHandler(log *zerolog.Logger, cfg config.StreamingConfig, c *cors.Cors, next http.Handler) http.Handler {
+	streamingLogger := log.With().Str("source", "gateway-streaming").Logger()
+
+	return &streamingHandler{
+		logger: &streamingLogger,
+		cfg:    cfg,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				// non-browser clients don't send an origin
+				return r.Header.Get("Origin") == "" || c.OriginAllowed(r)
+			},
+		},
+		next: next,
+	}
+}
+
+func (s *streamingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case websocket.IsWebSocketUpgrade(r):
+		s.serveWebSocket(w, r)
+	case acceptsEventStream(r):
+		s.serveEventStream(w, r)
+	default:
+		s.next.ServeHTTP(w, r)
+	}
+}
+
+func (s *streamingHandler) pingInterval() time.Duration {
+	return time.Duration(s.cfg.PingIntervalSeconds) * time.Second
+}
+
+func (s *streamingHandler) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied to the client
+		s.logger.Debug().Err(err).Msg("websocket upgrade failed")
+		return
+	}
+	defer conn.Close()
+
+	// canceling the context cancels the gRPC stream
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	bodyReader, bodyWriter := io.Pipe()
+	defer bodyReader.Close()
+
+	out := make(chan []byte, s.cfg.SendBufferSize)
+	writerDone := make(chan struct{})
+
+	go s.readWebSocket(conn, bodyWriter, cancel)
+	go func() {
+		defer close(writerDone)
+		s.writeWebSocket(ctx, conn, out, cancel)
+	}()
+
+	rw := newStreamResponseWriter(func(_ int, _ http.Header, msg []byte) error {
+		// blocks while the client is slow, which stops reading from the gRPC stream
+		select {
+		case out <- msg:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	s.next.ServeHTTP(rw, streamRequest(ctx, r, bodyReader, http.MethodPost))
+
+	if err := rw.flushMessage(); err != nil {
+		s.logger.Debug().Err(err).Msg("failed to send last websocket message")
+	}
+	close(out)
+	<-writerDone
+}
+
+// readWebSocket forwards incoming messages to the request body.
+// It cancels the request when the socket is closed or stops answering pings.
+func (s *streamingHandler) readWebSocket(conn *websocket.Conn, body *io.PipeWriter, cancel context.CancelFunc) {
+	defer cancel()
+
+	conn.SetReadLimit(s.cfg.MaxMessageBytes)
+
+	extendDeadline := func(string) error {
+		if s.pingInterval() == 0 {
+			return nil
+		}
+		return conn.SetReadDeadline(time.Now().Add(2 * s.pingInterval()))
+	}
+	_ = extendDeadline("")
+	conn.SetPongHandler(extendDeadline)
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.logger.Debug().Err(err).Msg("websocket closed")
+			}
+			body.CloseWithError(err)
+			return
+		}
+
+		_ = extendDeadline("")
+
+		if _, err := body.Write(append(msg, streamDelimiter...)); err != nil {
+			return
+		}
+	}
+}
+
+// writeWebSocket sends responses and keepalive pings to the client, and
+// closes the socket gracefully once all responses have been sent.
+func (s *streamingHandler) writeWebSocket(ctx context.Context, conn *websocket.Conn, out <-chan []byte, cancel context.CancelFunc) {
+	var ping <-chan time.Time
+	if s.pingInterval() > 0 {
+		ticker := time.NewTicker(s.pingInterval())
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		select {
+		case msg, ok := <-out:
+			if !ok {
+				_ = conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+					time.Now().Add(writeTimeout),
+				)
+				return
+			}
+
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				s.logger.Debug().Err(err).Msg("failed to write websocket message")
+				cancel()
+				return
+			}
+		case <-ping:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				cancel()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *streamingHandler) serveEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		started  bool
+		finished bool
+	)
+
+	write := func(p []byte) error {
+		if _, err := w.Write(p); err != nil {
+			cancel()
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	rw := newStreamResponseWriter(func(status int, header http.Header, msg []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !started {
+			startEventStream(w, status, header)
+			started = true
+		}
+
+		event := ""
+		if status >= http.StatusBadRequest {
+			event = "error"
+		}
+
+		return write(formatEvent(event, msg))
+	})
+
+	if s.pingInterval() > 0 {
+		ticker := time.NewTicker(s.pingInterval())
+		defer ticker.Stop()
+
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					mu.Lock()
+					if started && !finished {
+						_ = write([]byte(": ping\n\n"))
+					}
+					mu.Unlock()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	body := strings.NewReader(r.URL.Query().Get(bodyQueryParam))
+	s.next.ServeHTTP(rw, streamRequest(ctx, r, body, r.Method))
+
+	if err := rw.flushMessage(); err != nil {
+		s.logger.Debug().Err(err).Msg("failed to send last event")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !started {
+		startEventStream(w, rw.statusCode(), rw.Header())
+	}
+
+	// tell EventSource clients that the stream is over, so they don't reconnect
+	_ = write(formatEvent("end", []byte("{}")))
+	finished = true
+}
+
+func startEventStream(w http.ResponseWriter, status int, header http.Header) {
+	for k, vs := range header {
+		switch k {
+		case "Content-Type", "Content-Length", "Transfer-Encoding":
+			continue
+		}
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+
+	w.Header().Set("Content-Type", eventStreamMIME)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(status)
+}
+
+func formatEvent(event string, data []byte) []byte {
+	buf := bytes.Buffer{}
+	if event != "" {
+		buf.WriteString("event: " + event + "\n")
+	}
+
+	for _, line := range bytes.Split(bytes.TrimRight(data, "\n"), streamDelimiter) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes()
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		if strings.Contains(accept, eventStreamMIME) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// streamRequest creates the request that is forwarded to the gateway,
+// applying the method and access token query parameters.
+func streamRequest(ctx context.Context, r *http.Request, body io.Reader, method string) *http.Request {
+	req := r.Clone(ctx)
+
+	query := req.URL.Query()
+	if m := query.Get(methodQueryParam); m != "" {
+		method = strings.ToUpper(m)
+	}
+	if token := query.Get(accessTokenQueryParam); token != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	query.Del(methodQueryParam)
+	query.Del(accessTokenQueryParam)
+	query.Del(bodyQueryParam)
+
+	for _, h := range webSocketHeaders {
+		req.Header.Del(h)
+	}
+
+	req.Method = method
+	req.URL.RawQuery = query.Encode()
+	req.RequestURI = req.URL.RequestURI()
+	req.Body = io.NopCloser(body)
+	req.ContentLength = -1
+
+	return req
+}
+
+// streamResponseWriter splits the gateway response into messages.
+// The gateway writes the delimiter separately after each message of a stream,
+// and unary responses are a single message.
+type streamResponseWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+	send   func(status int, header http.Header, msg []byte) error
+}
+
+func newStreamResponseWriter(send func(status int, header http.Header, msg []byte) error) *streamResponseWriter {
+	return &streamResponseWriter{
+		header: http.Header{},
+		send:   send,
+	}
+}
+
+func (w *streamResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *streamResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *streamResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+
+	if bytes.Equal(p, streamDelimiter) {
+		return len(p), w.flushMessage()
+	}
+
+	return w.buf.Write(p)
+}
+
+// Flush is a no-op, messages are sent as soon as they are complete.
+func (w *streamResponseWriter) Flush() {}
+
+func (w *streamResponseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *streamResponseWriter) flushMessage() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	msg := make([]byte, w.buf.Len())
+	copy(msg, w.buf.Bytes())
+	w.buf.Reset()
+
+	return w.send(w.statusCode(), w.header, msg)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
+)
+
+// systemdPollInterval is how often the readiness is checked to notify systemd,
+// unless the watchdog needs to be notified more often
+const systemdPollInterval = time.Second
+
+// ActivatedListeners uses the sockets passed by systemd socket activation,
+// and listens on the configured addresses for the other servers. Sockets are
+// matched with servers by their FileDescriptorName, one of the Listener* constants.
+// Sockets that no server uses, e.g. because it's disabled, are closed once the
+// servers are started. Without socket activation, it's the same as TCPListeners.
+func ActivatedListeners(c *cc.CC) (Listeners, error) {
+	activated, err := activatedListeners()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(activated) == 0 {
+		return TCPListeners(), nil
+	}
+
+	for name := range activated {
+		switch name {
+		case ListenerHealth, ListenerGRPC, ListenerGateway, ListenerGRPCWeb:
+		default:
+			closeListeners(activated)
+			return nil, errors.Errorf("unknown socket name '%s', set FileDescriptorName to one of %s, %s, %s or %s",
+				name, ListenerHealth, ListenerGRPC, ListenerGateway, ListenerGRPCWeb)
+		}
+	}
+
+	var mu sync.Mutex
+	log := c.Log.With().Str("component", "listeners").Logger()
+
+	err = c.Lifecycle.Register(cc.Component{
+		Name:      componentUnusedListeners,
+		DependsOn: []string{componentReadiness},
+		Start: func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			for name := range activated {
+				log.Warn().Str("name", name).Msg("closing activated socket that isn't used by any server")
+			}
+			closeListeners(activated)
+
+			return nil
+		},
+	})
+	if err != nil {
+		closeListeners(activated)
+		return nil, errors.Wrap(err, "failed to register activated listeners")
+	}
+
+	return func(name, address string) (net.Listener, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if lis, ok := activated[name]; ok {
+			delete(activated, name)
+			return lis, nil
+		}
+
+		return net.Listen("tcp", address)
+	}, nil
+}
+
+// closeListeners closes and removes all listeners.
+func closeListeners(listeners map[string]net.Listener) {
+	for name, lis := range listeners {
+		_ = lis.Close()
+		delete(listeners, name)
+	}
+}
+
+// systemdComponent notifies systemd when the server is ready and when it stops,
+// and pings the watchdog while the server is ready.
+func (s *Server) systemdComponent() cc.Component {
+	return cc.Component{
+		Name:      componentSystemd,
+		DependsOn: []string{componentReadiness},
+		Start: func(context.Context) error {
+			s.startSystemdNotify()
+			return nil
+		},
+		Stop: func(context.Context) error {
+			s.systemdCancel()
+
+			// the new process is the main process of the service now
+			if s.isHandedOff() {
+				return nil
+			}
+
+			return errors.Wrap(sdNotify("STOPPING=1"), "failed to notify systemd")
+		},
+	}
+}
+
+func (s *Server) startSystemdNotify() {
+	ctx, cancel := context.WithCancel(s.Context)
+	s.systemdCancel = cancel
+
+	watchdog := watchdogInterval()
+	interval := systemdPollInterval
+	if watchdog > 0 && watchdog/2 < interval {
+		interval = watchdog / 2
+	}
+
+	s.Supervisor.Go(cc.Worker{
+		Name:    "systemd-notify",
+		Restart: cc.RestartOnFailure,
+		Run: func(workerCtx context.Context) error {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			ready := false
+			for {
+				if s.serving() {
+					if !ready {
+						if err := sdNotify("READY=1"); err != nil {
+							return errors.Wrap(err, "failed to notify systemd")
+						}
+						s.logger.Info().Msg("notified systemd that the server is ready")
+						ready = true
+					}
+
+					if watchdog > 0 {
+						if err := sdNotify("WATCHDOG=1"); err != nil {
+							return errors.Wrap(err, "failed to notify systemd watchdog")
+						}
+					}
+				}
+
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-workerCtx.Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
+		},
+	})
+}
+
+// serving returns true if the server reports that it's ready.
+func (s *Server) serving() bool {
+	resp, err := s.healthServer.Server.Check(s.Context, &healthpb.HealthCheckRequest{Service: healthServiceName})
+
+	return err == nil && resp.GetStatus() == healthpb.HealthCheckResponse_SERVING
+}
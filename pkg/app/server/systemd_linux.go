@@ -0,0 +1,125 @@
+//go:build linux
+// +build linux
+
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd
+const listenFDsStart = 3
+
+// activatedListeners returns the sockets passed by systemd, or by the process
+// that handed its listeners off, by name. The environment variables are removed,
+// so child processes don't inherit them. See sd_listen_fds(3).
+func activatedListeners() (map[string]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+		_ = os.Unsetenv(handoffFDNamesEnv)
+	}()
+
+	if handoff := os.Getenv(handoffFDNamesEnv); handoff != "" {
+		names := strings.Split(handoff, ":")
+		return fileListeners(names, len(names))
+	}
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count == 0 {
+		return nil, nil
+	}
+
+	return fileListeners(strings.Split(os.Getenv("LISTEN_FDNAMES"), ":"), count)
+}
+
+// fileListeners creates listeners from count file descriptors, starting with
+// listenFDsStart, with the given names.
+// On error, all the file descriptors are closed.
+func fileListeners(names []string, count int) (map[string]net.Listener, error) {
+	listeners := map[string]net.Listener{}
+
+	for i := 0; i < count; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(fd), name)
+		lis, err := net.FileListener(f)
+		_ = f.Close()
+		if err == nil {
+			if _, ok := listeners[name]; ok {
+				_ = lis.Close()
+				err = errors.Errorf("socket name '%s' isn't unique", name)
+			}
+		} else {
+			err = errors.Wrapf(err, "socket '%s' isn't a listener", name)
+		}
+
+		if err != nil {
+			closeListeners(listeners)
+			for j := i + 1; j < count; j++ {
+				_ = syscall.Close(listenFDsStart + j)
+			}
+			return nil, err
+		}
+		listeners[name] = lis
+	}
+
+	return listeners, nil
+}
+
+// systemdNotifyEnabled returns true if the service manager expects notifications.
+func systemdNotifyEnabled() bool {
+	return os.Getenv("NOTIFY_SOCKET") != ""
+}
+
+// sdNotify sends a state to the service manager, see sd_notify(3).
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to the notify socket")
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+
+	return errors.Wrap(err, "failed to write to the notify socket")
+}
+
+// watchdogInterval returns how often the service manager expects to be
+// notified, or 0 if the watchdog isn't enabled. See sd_watchdog_enabled(3).
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
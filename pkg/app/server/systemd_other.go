@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package server
+
+import (
+	"net"
+	"time"
+)
+
+// systemd is only supported on Linux
+
+func activatedListeners() (map[string]net.Listener, error) {
+	return nil, nil
+}
+
+func systemdNotifyEnabled() bool {
+	return false
+}
+
+func sdNotify(string) error {
+	return nil
+}
+
+func watchdogInterval() time.Duration {
+	return 0
+}
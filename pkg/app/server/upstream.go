@@ -0,0 +1,268 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aserto-dev/go-utils/certs"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+)
+
+const (
+	inProcessBufferSize = 1024 * 1024
+	inProcessTarget     = "inprocess"
+
+	upstreamWatchBackoff = time.Second
+)
+
+// inProcessCreds uses TLS for all connections of the gRPC server, except for
+// the in-memory connections of the gateway, which never leave the process.
+type inProcessCreds struct {
+	credentials.TransportCredentials
+}
+
+func (c *inProcessCreds) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if _, ok := conn.(inProcessConn); ok {
+		return insecure.NewCredentials().ServerHandshake(conn)
+	}
+
+	return c.TransportCredentials.ServerHandshake(conn)
+}
+
+func (c *inProcessCreds) Clone() credentials.TransportCredentials {
+	return &inProcessCreds{TransportCredentials: c.TransportCredentials.Clone()}
+}
+
+// inProcessListener marks the connections accepted from the gateway, so
+// inProcessCreds can tell them apart from other in-memory connections.
+type inProcessListener struct {
+	*bufconn.Listener
+}
+
+func (l inProcessListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return inProcessConn{Conn: conn}, nil
+}
+
+type inProcessConn struct {
+	net.Conn
+}
+
+// upstreamScheme is the resolver scheme of upstreams with a list of targets.
+const upstreamScheme = "upstream"
+
+// dialUpstream creates the connection used by the gateway to reach the gRPC
+// services of an upstream. The default upstream has an empty name.
+// The connection is established in the background, so a slow or unavailable
+// upstream doesn't prevent the gateway from starting.
+func dialUpstream(ctx context.Context, cfg *config.Config, name string, inProcess *bufconn.Listener) (*grpc.ClientConn, error) {
+	upstream := cfg.Upstream(name)
+
+	if upstream.Mode == config.UpstreamInProcess {
+		conn, err := grpc.DialContext(ctx, inProcessTarget,
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return inProcess.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		return conn, errors.Wrap(err, "failed to create in-process connection")
+	}
+
+	upstreamCerts := upstream.Certs
+	if upstreamCerts.TLSCACertPath == "" {
+		upstreamCerts = cfg.API.Gateway.Upstream.Certs
+	}
+	if upstreamCerts.TLSCACertPath == "" {
+		upstreamCerts = cfg.API.GRPC.Certs
+	}
+
+	tlsCreds, err := certs.GatewayAsClientTLSCreds(upstreamCerts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to calculate tls config for upstream '%s'", name)
+	}
+
+	serviceConfig, err := upstreamServiceConfig(&upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(tlsCreds),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+	}
+
+	var address string
+	if len(upstream.Targets) > 0 {
+		r := manual.NewBuilderWithScheme(upstreamScheme)
+		state := resolver.State{}
+		for _, target := range upstream.Targets {
+			host, _, err := net.SplitHostPort(target)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid target '%s' of upstream '%s'", target, name)
+			}
+			// each backend is verified against its own host name
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: target, ServerName: host})
+		}
+		r.InitialState(state)
+
+		address = fmt.Sprintf("%s:///%s", upstreamScheme, name)
+		opts = append(opts, grpc.WithResolvers(r))
+	} else if address, err = upstreamAddress(cfg, &upstream); err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.DialContext(ctx, address, opts...)
+	return conn, errors.Wrapf(err, "failed to create connection to %s", address)
+}
+
+// serviceConfig is the JSON representation of a gRPC service config.
+// see https://github.com/grpc/grpc/blob/master/doc/service_config.md
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig,omitempty"`
+	HealthCheckConfig   *healthCheckConfig    `json:"healthCheckConfig,omitempty"`
+	MethodConfig        []methodConfig        `json:"methodConfig,omitempty"`
+}
+
+type healthCheckConfig struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type methodConfig struct {
+	// an empty name applies to all methods
+	Name        []struct{}   `json:"name"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          uint32   `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// upstreamServiceConfig balances calls across the backends of an upstream,
+// optionally skipping unhealthy ones, and retries calls that fail because
+// the upstream is unavailable.
+func upstreamServiceConfig(upstream *config.UpstreamConfig) (string, error) {
+	sc := serviceConfig{
+		LoadBalancingConfig: []map[string]struct{}{{upstream.Balancer: {}}},
+	}
+
+	if upstream.HealthCheck.Enabled {
+		sc.HealthCheckConfig = &healthCheckConfig{ServiceName: upstream.HealthCheck.Service}
+	}
+
+	if retry := upstream.Retry; retry.MaxAttempts > 1 {
+		sc.MethodConfig = append(sc.MethodConfig, methodConfig{
+			Name: []struct{}{{}},
+			RetryPolicy: &retryPolicy{
+				MaxAttempts:          retry.MaxAttempts,
+				InitialBackoff:       durationString(retry.InitialBackoffMs),
+				MaxBackoff:           durationString(retry.MaxBackoffMs),
+				BackoffMultiplier:    retry.BackoffMultiplier,
+				RetryableStatusCodes: []string{code.Code_UNAVAILABLE.String()},
+			},
+		})
+	}
+
+	buf, err := json.Marshal(sc)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal upstream service config")
+	}
+
+	return string(buf), nil
+}
+
+// durationString formats milliseconds as a protobuf JSON duration.
+func durationString(ms uint32) string {
+	return fmt.Sprintf("%.3fs", float64(ms)/1000)
+}
+
+// upstreamsHealth reports the gateway as serving only while all of its upstreams are.
+type upstreamsHealth struct {
+	mu           sync.Mutex
+	serving      map[string]bool
+	healthServer *health.Server
+}
+
+func newUpstreamsHealth(healthServer *health.Server) *upstreamsHealth {
+	return &upstreamsHealth{serving: map[string]bool{}, healthServer: healthServer}
+}
+
+func (h *upstreamsHealth) set(name string, serving bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.serving[name] = serving
+
+	status := healthpb.HealthCheckResponse_SERVING
+	for _, ok := range h.serving {
+		if !ok {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+
+	h.healthServer.SetServingStatus(healthServiceName, status)
+}
+
+// watch follows the health of an upstream until ctx is done.
+func (h *upstreamsHealth) watch(ctx context.Context, log *zerolog.Logger, name, service string, conn *grpc.ClientConn) {
+	client := healthpb.NewHealthClient(conn)
+	for ctx.Err() == nil {
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err == nil {
+			for {
+				resp, err := stream.Recv()
+				if err != nil {
+					break
+				}
+
+				log.Debug().Str("upstream", name).Str("status", resp.GetStatus().String()).Msg("upstream health changed")
+				h.set(name, resp.GetStatus() == healthpb.HealthCheckResponse_SERVING)
+			}
+		}
+
+		h.set(name, false)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(upstreamWatchBackoff):
+		}
+	}
+}
+
+// upstreamAddress returns the configured upstream address, defaulting to the
+// local gRPC listener.
+func upstreamAddress(cfg *config.Config, upstream *config.UpstreamConfig) (string, error) {
+	if upstream.Address != "" {
+		return upstream.Address, nil
+	}
+
+	_, port, err := net.SplitHostPort(cfg.API.GRPC.ListenAddress)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine port from configured GRPC listen address")
+	}
+
+	return fmt.Sprintf("dns:///127.0.0.1:%s", port), nil
+}
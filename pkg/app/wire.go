@@ -5,10 +5,10 @@ package app
 import (
 	"github.com/google/wire"
 	"github.com/aserto-dev/go-utils/logger"
-	"github.com/aserto-dev/go-sample-project/pkg/app/impl"
 	"github.com/aserto-dev/go-sample-project/pkg/app/server"
 	"github.com/aserto-dev/go-sample-project/pkg/cc"
 	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	"github.com/aserto-dev/go-sample-project/pkg/module"
 )
 
 var (
@@ -18,8 +18,11 @@ var (
 		GRPCServerRegistrations,
 		GatewayServerRegistrations,
 		server.NewServer,
+		server.ActivatedListeners,
 
-		impl.NewInfo,
+		module.Load,
+		ServerMiddleware,
+		ServerHealthChecks,
 
 		wire.FieldsOf(new(*cc.CC), "Config", "Log", "Context", "ErrGroup"),
 	)
@@ -33,7 +36,25 @@ var (
 		GatewayServerRegistrations,
 		server.NewServer,
 
-		impl.NewInfo,
+		module.Load,
+		ServerMiddleware,
+		ServerHealthChecks,
+
+		wire.FieldsOf(new(*cc.CC), "Config", "Log", "Context", "ErrGroup"),
+	)
+
+	gosampleprojectHostedSet = wire.NewSet(
+		// Hosted
+		cc.NewHostedCC,
+		extendedGRPCServerRegistrations,
+		extendedGatewayServerRegistrations,
+		extendedServerMiddleware,
+
+		// Normal
+		server.NewServer,
+
+		module.Load,
+		ServerHealthChecks,
 
 		wire.FieldsOf(new(*cc.CC), "Config", "Log", "Context", "ErrGroup"),
 	)
@@ -57,6 +78,7 @@ func BuildTestGoSampleProject(
 	errWriter logger.ErrWriter,
 	configPath config.Path,
 	overrides config.Overrider,
+	listeners server.Listeners,
 ) (*GoSampleProject, func(), error) {
 	wire.Build(
 		wire.Struct(new(GoSampleProject), "*"),
@@ -64,3 +86,17 @@ func BuildTestGoSampleProject(
 	)
 	return &GoSampleProject{}, func() {}, nil
 }
+
+func BuildHostedGoSampleProject(
+	host cc.Host,
+	configPath config.Path,
+	overrides config.Overrider,
+	listeners server.Listeners,
+	extensions *Extensions,
+) (*GoSampleProject, func(), error) {
+	wire.Build(
+		wire.Struct(new(GoSampleProject), "*"),
+		gosampleprojectHostedSet,
+	)
+	return &GoSampleProject{}, func() {}, nil
+}
@@ -7,14 +7,18 @@
 package app
 
 import (
-	"github.com/aserto-dev/go-sample-project/pkg/app/impl"
 	"github.com/aserto-dev/go-sample-project/pkg/app/server"
 	"github.com/aserto-dev/go-sample-project/pkg/cc"
 	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	"github.com/aserto-dev/go-sample-project/pkg/module"
 	"github.com/aserto-dev/go-utils/logger"
 	"github.com/google/wire"
 )
 
+import (
+	_ "github.com/aserto-dev/go-sample-project/pkg/app/impl"
+)
+
 // Injectors from wire.go:
 
 func BuildGoSampleProject(logWriter logger.Writer, errWriter logger.ErrWriter, configPath config.Path, overrides config.Overrider) (*GoSampleProject, func(), error) {
@@ -25,10 +29,21 @@ func BuildGoSampleProject(logWriter logger.Writer, errWriter logger.ErrWriter, c
 	context := ccCC.Context
 	zerologLogger := ccCC.Log
 	configConfig := ccCC.Config
-	info := impl.NewInfo(zerologLogger, configConfig)
-	registrations := GRPCServerRegistrations(info)
-	handlerRegistrations := GatewayServerRegistrations()
-	serverServer, cleanup2, err := server.NewServer(ccCC, registrations, handlerRegistrations)
+	modules, err := module.Load(ccCC)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	registrations := GRPCServerRegistrations(modules)
+	handlerRegistrations := GatewayServerRegistrations(modules)
+	listeners, err := server.ActivatedListeners(ccCC)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	middleware := ServerMiddleware(modules)
+	healthChecks := ServerHealthChecks(modules)
+	serverServer, cleanup2, err := server.NewServer(ccCC, registrations, handlerRegistrations, listeners, middleware, healthChecks)
 	if err != nil {
 		cleanup()
 		return nil, nil, err
@@ -45,7 +60,7 @@ func BuildGoSampleProject(logWriter logger.Writer, errWriter logger.ErrWriter, c
 	}, nil
 }
 
-func BuildTestGoSampleProject(logWriter logger.Writer, errWriter logger.ErrWriter, configPath config.Path, overrides config.Overrider) (*GoSampleProject, func(), error) {
+func BuildTestGoSampleProject(logWriter logger.Writer, errWriter logger.ErrWriter, configPath config.Path, overrides config.Overrider, listeners server.Listeners) (*GoSampleProject, func(), error) {
 	ccCC, cleanup, err := cc.NewTestCC(logWriter, errWriter, configPath, overrides)
 	if err != nil {
 		return nil, nil, err
@@ -53,10 +68,50 @@ func BuildTestGoSampleProject(logWriter logger.Writer, errWriter logger.ErrWrite
 	context := ccCC.Context
 	zerologLogger := ccCC.Log
 	configConfig := ccCC.Config
-	info := impl.NewInfo(zerologLogger, configConfig)
-	registrations := GRPCServerRegistrations(info)
-	handlerRegistrations := GatewayServerRegistrations()
-	serverServer, cleanup2, err := server.NewServer(ccCC, registrations, handlerRegistrations)
+	modules, err := module.Load(ccCC)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	registrations := GRPCServerRegistrations(modules)
+	handlerRegistrations := GatewayServerRegistrations(modules)
+	middleware := ServerMiddleware(modules)
+	healthChecks := ServerHealthChecks(modules)
+	serverServer, cleanup2, err := server.NewServer(ccCC, registrations, handlerRegistrations, listeners, middleware, healthChecks)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	goSampleProject := &GoSampleProject{
+		Context:       context,
+		Logger:        zerologLogger,
+		Configuration: configConfig,
+		Server:        serverServer,
+	}
+	return goSampleProject, func() {
+		cleanup2()
+		cleanup()
+	}, nil
+}
+
+func BuildHostedGoSampleProject(host cc.Host, configPath config.Path, overrides config.Overrider, listeners server.Listeners, extensions *Extensions) (*GoSampleProject, func(), error) {
+	ccCC, cleanup, err := cc.NewHostedCC(host, configPath, overrides)
+	if err != nil {
+		return nil, nil, err
+	}
+	context := ccCC.Context
+	zerologLogger := ccCC.Log
+	configConfig := ccCC.Config
+	modules, err := module.Load(ccCC)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	registrations := extendedGRPCServerRegistrations(modules, extensions)
+	handlerRegistrations := extendedGatewayServerRegistrations(modules, extensions)
+	middleware := extendedServerMiddleware(modules, extensions)
+	healthChecks := ServerHealthChecks(modules)
+	serverServer, cleanup2, err := server.NewServer(ccCC, registrations, handlerRegistrations, listeners, middleware, healthChecks)
 	if err != nil {
 		cleanup()
 		return nil, nil, err
@@ -77,10 +132,17 @@ func BuildTestGoSampleProject(logWriter logger.Writer, errWriter logger.ErrWrite
 
 var (
 	gosampleprojectSet = wire.NewSet(cc.NewCC, GRPCServerRegistrations,
-		GatewayServerRegistrations, server.NewServer, impl.NewInfo, wire.FieldsOf(new(*cc.CC), "Config", "Log", "Context", "ErrGroup"),
+		GatewayServerRegistrations, server.NewServer, server.ActivatedListeners, module.Load, ServerMiddleware,
+		ServerHealthChecks, wire.FieldsOf(new(*cc.CC), "Config", "Log", "Context", "ErrGroup"),
 	)
 
 	gosampleprojectTestSet = wire.NewSet(cc.NewTestCC, GRPCServerRegistrations,
-		GatewayServerRegistrations, server.NewServer, impl.NewInfo, wire.FieldsOf(new(*cc.CC), "Config", "Log", "Context", "ErrGroup"),
+		GatewayServerRegistrations, server.NewServer, module.Load, ServerMiddleware,
+		ServerHealthChecks, wire.FieldsOf(new(*cc.CC), "Config", "Log", "Context", "ErrGroup"),
+	)
+
+	gosampleprojectHostedSet = wire.NewSet(cc.NewHostedCC, extendedGRPCServerRegistrations,
+		extendedGatewayServerRegistrations,
+		extendedServerMiddleware, server.NewServer, module.Load, ServerHealthChecks, wire.FieldsOf(new(*cc.CC), "Config", "Log", "Context", "ErrGroup"),
 	)
 )
@@ -2,10 +2,10 @@ package cc
 
 import (
 	"context"
-	"sync"
 
 	"github.com/aserto-dev/go-utils/logger"
 	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/slok/go-http-metrics/metrics"
 	"golang.org/x/sync/errgroup"
@@ -18,47 +18,50 @@ type CC struct {
 	Config          *config.Config
 	Log             *zerolog.Logger
 	ErrGroup        *errgroup.Group
+	MetricsRegistry *prometheus.Registry
 	MetricsRecorder metrics.Recorder
+	Lifecycle       *Lifecycle
+	Supervisor      *Supervisor
 }
 
-var (
-	once         sync.Once
-	cc           *CC
-	cleanup      func()
-	singletonErr error
-)
-
-// NewCC creates a singleton CC
+// NewCC creates a CC. Every call creates a new instance with its own config,
+// logger, metrics and error group, so several applications can run in the same
+// process. Their contexts are all canceled by the termination signals, which are
+// handled once per process. The first call also applies the process wide settings,
+// and redirects the standard library and gRPC logs to its logger, see RedirectGlobalLogs.
 func NewCC(
 	logOutput logger.Writer,
 	errOutput logger.ErrWriter,
 	configPath config.Path,
 	overrides config.Overrider,
 ) (*CC, func(), error) {
-	once.Do(func() {
-		cc, cleanup, singletonErr = buildCC(logOutput, errOutput, configPath, overrides)
-	})
+	if err := setupProcess(); err != nil {
+		return nil, nil, err
+	}
+
+	cc, cleanup, err := buildCC(logOutput, errOutput, configPath, overrides)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	RedirectGlobalLogs(cc.Log)
 
-	return cc, func() {
-		cleanup()
-		once = sync.Once{}
-	}, singletonErr
+	return cc, cleanup, nil
 }
 
-// NewTestCC creates a singleton CC to be used for testing.
+// NewTestCC creates a CC to be used for testing.
 // It uses a fake context (context.Background)
+// Unlike NewCC, it doesn't redirect the global logs, which would otherwise
+// end up in the output of the first test.
 func NewTestCC(
 	logOutput logger.Writer,
 	errOutput logger.ErrWriter,
 	configPath config.Path,
 	overrides config.Overrider,
 ) (*CC, func(), error) {
-	once.Do(func() {
-		cc, cleanup, singletonErr = buildTestCC(logOutput, errOutput, configPath, overrides)
-	})
+	if err := setupProcess(); err != nil {
+		return nil, nil, err
+	}
 
-	return cc, func() {
-		cleanup()
-		once = sync.Once{}
-	}, singletonErr
+	return buildTestCC(logOutput, errOutput, configPath, overrides)
 }
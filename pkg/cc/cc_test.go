@@ -0,0 +1,47 @@
+package cc_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aserto-dev/go-utils/certs"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+)
+
+func TestNewCCInstances(t *testing.T) {
+	assert := require.New(t)
+
+	// the certificates aren't generated if one of them exists
+	existing := filepath.Join(t.TempDir(), "existing.crt")
+	assert.NoError(os.WriteFile(existing, nil, 0o600))
+
+	newCC := func(address string) (*cc.CC, func()) {
+		c, cleanup, err := cc.NewCC(io.Discard, io.Discard, "", func(cfg *config.Config) {
+			creds := certs.TLSCredsConfig{TLSKeyPath: existing, TLSCertPath: existing, TLSCACertPath: existing}
+			cfg.API.GRPC.Certs = creds
+			cfg.API.Gateway.Certs = creds
+			cfg.API.GRPC.ListenAddress = address
+		})
+		assert.NoError(err)
+
+		return c, cleanup
+	}
+
+	first, cleanupFirst := newCC("127.0.0.1:1")
+	defer cleanupFirst()
+	second, cleanupSecond := newCC("127.0.0.1:2")
+	defer cleanupSecond()
+
+	assert.Equal("127.0.0.1:1", first.Config.API.GRPC.ListenAddress)
+	assert.Equal("127.0.0.1:2", second.Config.API.GRPC.ListenAddress)
+	assert.NotSame(first.MetricsRegistry, second.MetricsRegistry)
+	assert.NotSame(first.Lifecycle, second.Lifecycle)
+	assert.NotSame(first.ErrGroup, second.ErrGroup)
+	assert.NoError(first.Context.Err())
+	assert.NoError(second.Context.Err())
+}
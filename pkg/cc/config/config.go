@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 
 	"github.com/aserto-dev/go-utils/certs"
@@ -18,6 +19,31 @@ var (
 	DefaultTLSGenDir = os.ExpandEnv("$HOME/.config/aserto/go-sample-project/certs")
 )
 
+// Modes in which the gateway reaches the gRPC services.
+const (
+	// UpstreamInProcess dispatches gateway calls to the gRPC server of this
+	// process over an in-memory connection
+	UpstreamInProcess = "inprocess"
+	// UpstreamRemote dials the gRPC server at the upstream address using TLS
+	UpstreamRemote = "remote"
+)
+
+// Load balancing policies of remote upstreams.
+const (
+	BalancerRoundRobin   = "round_robin"
+	BalancerLeastRequest = "least_request"
+)
+
+// Roles select which servers are run by a process.
+const (
+	// RoleAll runs the gRPC server and the gateway
+	RoleAll = "all"
+	// RoleGRPC runs the gRPC server without the gateway
+	RoleGRPC = "grpc"
+	// RoleGateway runs the gateway in front of a remote gRPC upstream
+	RoleGateway = "gateway"
+)
+
 // Overrider is a func that mutates configuration
 type Overrider func(*Config)
 
@@ -25,6 +51,8 @@ type Overrider func(*Config)
 type Config struct {
 	Logging logger.Config `json:"logging"`
 	API     struct {
+		// One of all, grpc or gateway
+		Role string `json:"role"`
 		GRPC struct {
 			ListenAddress string `json:"listen_address"`
 			// Default connection timeout is 120 seconds
@@ -35,11 +63,85 @@ type Config struct {
 		Gateway struct {
 			ListenAddress string               `json:"listen_address"`
 			Certs         certs.TLSCredsConfig `json:"certs"`
+			Streaming     StreamingConfig      `json:"streaming"`
+			// Upstream serves all services that are not routed to one of the Upstreams
+			Upstream UpstreamConfig `json:"upstream"`
+			// Upstreams are additional gRPC backends, keyed by name
+			Upstreams map[string]UpstreamConfig `json:"upstreams"`
 		} `json:"gateway"`
 		Health struct {
 			ListenAddress string `json:"listen_address"`
 		} `json:"health"`
+		GRPCWeb struct {
+			Enabled bool `json:"enabled"`
+			// If empty, gRPC-Web is served on the gateway listener
+			ListenAddress string `json:"listen_address"`
+		} `json:"grpc_web"`
+		Connect struct {
+			// Serves unary RPCs over the Connect protocol on the gateway listener,
+			// disabled by default
+			Enabled bool `json:"enabled"`
+		} `json:"connect"`
 	} `json:"api"`
+	// Modules configures the modules of the application, keyed by name
+	Modules map[string]ModuleConfig `json:"modules"`
+}
+
+// ModuleConfig configures a module, see pkg/module.
+type ModuleConfig struct {
+	// Modules are enabled unless set to false
+	Enabled *bool `json:"enabled"`
+	// Config is the section of the module, decoded by the module itself
+	Config map[string]interface{} `json:"config"`
+}
+
+// StreamingConfig configures how streaming RPCs are exposed over
+// WebSockets and Server-Sent Events by the gateway.
+type StreamingConfig struct {
+	// Interval between keepalive pings sent to clients
+	PingIntervalSeconds uint32 `json:"ping_interval_seconds"`
+	// Maximum size of a message received over a WebSocket
+	MaxMessageBytes int64 `json:"max_message_bytes"`
+	// Number of responses buffered for a slow client before the gRPC stream stops being read
+	SendBufferSize uint32 `json:"send_buffer_size"`
+}
+
+// UpstreamConfig configures a gRPC backend of the gateway.
+type UpstreamConfig struct {
+	// One of inprocess or remote. Defaults to inprocess, or to remote for the
+	// gateway role, which has no gRPC server. Additional upstreams are always remote
+	Mode string `json:"mode"`
+	// gRPC target used in remote mode, defaults to the local gRPC listener
+	Address string `json:"address"`
+	// Addresses of the backends, balanced on the client side. Take precedence over Address
+	Targets []string `json:"targets"`
+	// Fully qualified names of the gRPC services routed to this upstream
+	Services []string `json:"services"`
+	// One of round_robin or least_request
+	Balancer    string `json:"balancer"`
+	HealthCheck struct {
+		// Only sends requests to backends that report serving
+		Enabled bool `json:"enabled"`
+		// Service whose health is checked, the empty name checks the backend as a whole.
+		// It's also used for the readiness of the gateway role
+		Service string `json:"service"`
+	} `json:"health_check"`
+	// Client certificates used in remote mode, default to the gRPC certificates
+	Certs certs.TLSCredsConfig `json:"certs"`
+	// Defaults to the retry policy of the default upstream
+	Retry RetryConfig `json:"retry"`
+}
+
+// RetryConfig configures how calls to an unavailable gRPC upstream are retried.
+type RetryConfig struct {
+	// Maximum number of attempts, including the original call. Retries are disabled if lower than 2
+	MaxAttempts uint32 `json:"max_attempts"`
+	// Backoff before the first retry
+	InitialBackoffMs uint32 `json:"initial_backoff_ms"`
+	// Upper bound of the exponential backoff
+	MaxBackoffMs uint32 `json:"max_backoff_ms"`
+	// Factor the backoff grows by after each retry
+	BackoffMultiplier float64 `json:"backoff_multiplier"`
 }
 
 // Path is a string that points to a config file
@@ -80,9 +182,23 @@ func NewConfig(configPath Path, log *zerolog.Logger, overrides Overrider, certsG
 	v.SetDefault("api.gateway.certs.tls_key_path", filepath.Join(DefaultTLSGenDir, "gateway.key"))
 	v.SetDefault("api.gateway.certs.tls_cert_path", filepath.Join(DefaultTLSGenDir, "gateway.crt"))
 	v.SetDefault("api.gateway.certs.tls_ca_cert_path", filepath.Join(DefaultTLSGenDir, "gateway-ca.crt"))
+	v.SetDefault("api.gateway.streaming.ping_interval_seconds", 30)
+	v.SetDefault("api.gateway.streaming.max_message_bytes", 4*1024*1024)
+	v.SetDefault("api.gateway.streaming.send_buffer_size", 16)
+	// depends on the role, see applyUpstreamDefaults
+	v.SetDefault("api.gateway.upstream.mode", "")
+	v.SetDefault("api.gateway.upstream.balancer", BalancerRoundRobin)
+	v.SetDefault("api.gateway.upstream.health_check.service", "grpc.health.v1.go-sample-project")
+	v.SetDefault("api.gateway.upstream.retry.max_attempts", 3)
+	v.SetDefault("api.gateway.upstream.retry.initial_backoff_ms", 100)
+	v.SetDefault("api.gateway.upstream.retry.max_backoff_ms", 2000)
+	v.SetDefault("api.gateway.upstream.retry.backoff_multiplier", 2)
+	v.SetDefault("api.role", RoleAll)
 	v.SetDefault("api.grpc.listen_address", "0.0.0.0:8282")
 	v.SetDefault("api.gateway.listen_address", "0.0.0.0:8383")
 	v.SetDefault("api.health.listen_address", "0.0.0.0:8484")
+	v.SetDefault("api.grpc_web.enabled", false)
+	v.SetDefault("api.connect.enabled", false)
 
 	configExists, err := fileExists(file)
 	if err != nil {
@@ -109,9 +225,21 @@ func NewConfig(configPath Path, log *zerolog.Logger, overrides Overrider, certsG
 		overrides(cfg)
 	}
 
+	cfg.applyUpstreamDefaults()
+
 	// This is where validation of config happens
 	err = func() error {
-		return nil
+		switch cfg.API.Role {
+		case RoleAll, RoleGRPC, RoleGateway:
+		default:
+			return errors.Errorf("unknown role '%s'", cfg.API.Role)
+		}
+
+		if err := cfg.Logging.ParseLogLevel(zerolog.DebugLevel); err != nil {
+			return err
+		}
+
+		return cfg.validateUpstreams()
 	}()
 
 	if err != nil {
@@ -139,6 +267,224 @@ func NewLoggerConfig(configPath Path, overrides Overrider) (*logger.Config, erro
 	return &cfg.Logging, nil
 }
 
+// Upstream returns the configuration of a gateway upstream.
+// The default upstream has an empty name.
+func (c *Config) Upstream(name string) UpstreamConfig {
+	if name == "" {
+		return c.API.Gateway.Upstream
+	}
+
+	return c.API.Gateway.Upstreams[name]
+}
+
+// ModuleEnabled returns false if the module with the given name is disabled.
+func (c *Config) ModuleEnabled(name string) bool {
+	enabled := c.Modules[name].Enabled
+
+	return enabled == nil || *enabled
+}
+
+// Copy returns a deep copy of the config, which shares no maps, slices or
+// pointers with it.
+func (c *Config) Copy() *Config {
+	cp := *c
+
+	cp.API.Gateway.Upstream = c.API.Gateway.Upstream.copy()
+	if c.API.Gateway.Upstreams != nil {
+		cp.API.Gateway.Upstreams = make(map[string]UpstreamConfig, len(c.API.Gateway.Upstreams))
+		for name, upstream := range c.API.Gateway.Upstreams {
+			cp.API.Gateway.Upstreams[name] = upstream.copy()
+		}
+	}
+
+	if c.Modules != nil {
+		cp.Modules = make(map[string]ModuleConfig, len(c.Modules))
+		for name, module := range c.Modules {
+			if module.Enabled != nil {
+				enabled := *module.Enabled
+				module.Enabled = &enabled
+			}
+			if module.Config != nil {
+				module.Config = copyValue(module.Config).(map[string]interface{})
+			}
+			cp.Modules[name] = module
+		}
+	}
+
+	return &cp
+}
+
+// Merge sets the fields of c to the ones of src that don't have their zero
+// value, so a partial config can be applied on top of the defaults. Maps and
+// slices of src replace the ones of c, and are copied.
+func (c *Config) Merge(src *Config) {
+	mergeValue(reflect.ValueOf(c).Elem(), reflect.ValueOf(src.Copy()).Elem())
+}
+
+func mergeValue(dst, src reflect.Value) {
+	if dst.Kind() != reflect.Struct {
+		if !src.IsZero() {
+			dst.Set(src)
+		}
+		return
+	}
+
+	for i := 0; i < dst.NumField(); i++ {
+		if dst.Field(i).CanSet() {
+			mergeValue(dst.Field(i), src.Field(i))
+		}
+	}
+}
+
+func (u UpstreamConfig) copy() UpstreamConfig {
+	if u.Targets != nil {
+		u.Targets = append([]string{}, u.Targets...)
+	}
+	if u.Services != nil {
+		u.Services = append([]string{}, u.Services...)
+	}
+
+	return u
+}
+
+// copyValue copies the maps and slices of a value decoded from the config file.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		cp := make(map[string]interface{}, len(v))
+		for key, field := range v {
+			cp[key] = copyValue(field)
+		}
+		return cp
+	case []interface{}:
+		cp := make([]interface{}, len(v))
+		for i := range v {
+			cp[i] = copyValue(v[i])
+		}
+		return cp
+	default:
+		return value
+	}
+}
+
+// applyUpstreamDefaults sets the mode of the default upstream according to the
+// role, and the mode of the named upstreams to remote, and their load balancing
+// policy and retries to the ones of the default upstream if they aren't set.
+// The map is replaced, so the one set by an override isn't modified.
+func (c *Config) applyUpstreamDefaults() {
+	gateway := &c.API.Gateway
+	if gateway.Upstream.Mode == "" {
+		gateway.Upstream.Mode = UpstreamInProcess
+		if c.API.Role == RoleGateway {
+			// the gRPC services are served by another process
+			gateway.Upstream.Mode = UpstreamRemote
+		}
+	}
+
+	if gateway.Upstreams == nil {
+		return
+	}
+
+	upstreams := make(map[string]UpstreamConfig, len(gateway.Upstreams))
+	for name, upstream := range gateway.Upstreams {
+		if upstream.Mode == "" {
+			upstream.Mode = UpstreamRemote
+		}
+
+		if upstream.Balancer == "" {
+			upstream.Balancer = gateway.Upstream.Balancer
+		}
+
+		if upstream.Retry.MaxAttempts == 0 {
+			upstream.Retry = gateway.Upstream.Retry
+		}
+
+		upstreams[name] = upstream
+	}
+
+	gateway.Upstreams = upstreams
+}
+
+func (c *Config) validateUpstreams() error {
+	gateway := c.API.Gateway
+
+	switch gateway.Upstream.Mode {
+	case UpstreamInProcess, UpstreamRemote:
+	default:
+		return errors.Errorf("unknown gateway upstream mode '%s'", gateway.Upstream.Mode)
+	}
+
+	if c.API.Role == RoleGateway && gateway.Upstream.Mode == UpstreamInProcess {
+		return errors.Errorf("the gateway role has no gRPC server, its upstream mode must be '%s'", UpstreamRemote)
+	}
+
+	if err := validateBalancer(gateway.Upstream.Balancer); err != nil {
+		return err
+	}
+
+	if err := validateRetry(gateway.Upstream.Retry); err != nil {
+		return errors.Wrap(err, "invalid retries of the gateway upstream")
+	}
+
+	routed := map[string]string{}
+	for name, upstream := range gateway.Upstreams {
+		if upstream.Mode != UpstreamRemote {
+			return errors.Errorf("upstream '%s' must be remote", name)
+		}
+
+		if upstream.Address == "" && len(upstream.Targets) == 0 {
+			return errors.Errorf("upstream '%s' has no address or targets", name)
+		}
+
+		if len(upstream.Services) == 0 {
+			return errors.Errorf("upstream '%s' has no services", name)
+		}
+
+		for _, service := range upstream.Services {
+			if other, ok := routed[service]; ok {
+				return errors.Errorf("service '%s' is routed to upstreams '%s' and '%s'", service, other, name)
+			}
+			routed[service] = name
+		}
+
+		if err := validateBalancer(upstream.Balancer); err != nil {
+			return err
+		}
+
+		if err := validateRetry(upstream.Retry); err != nil {
+			return errors.Wrapf(err, "invalid retries of upstream '%s'", name)
+		}
+	}
+
+	return nil
+}
+
+// validateRetry checks that gRPC accepts the retry policy, if retries are enabled.
+func validateRetry(retry RetryConfig) error {
+	if retry.MaxAttempts < 2 {
+		return nil
+	}
+
+	if retry.InitialBackoffMs == 0 || retry.MaxBackoffMs == 0 {
+		return errors.New("initial_backoff_ms and max_backoff_ms must be positive")
+	}
+
+	if retry.BackoffMultiplier <= 0 {
+		return errors.New("backoff_multiplier must be positive")
+	}
+
+	return nil
+}
+
+func validateBalancer(balancer string) error {
+	switch balancer {
+	case BalancerRoundRobin, BalancerLeastRequest:
+		return nil
+	default:
+		return errors.Errorf("unknown load balancing policy '%s'", balancer)
+	}
+}
+
 func fileExists(path string) (bool, error) {
 	if _, err := os.Stat(path); err == nil {
 		return true, nil
@@ -2,6 +2,10 @@ package context
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"golang.org/x/sync/errgroup"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
@@ -13,9 +17,19 @@ type ErrGroupAndContext struct {
 	ErrGroup *errgroup.Group
 }
 
+var (
+	signalOnce sync.Once
+	signalCtx  context.Context
+)
+
 // NewContext creates a context that responds to user signals
+// SIGINT, SIGTERM and SIGHUP cancel the context, so the application shuts down
+// gracefully. A second SIGINT or SIGTERM exits with status 1, a second SIGHUP
+// terminates the process.
+// The signals are handled once per process, every context created by NewContext
+// is canceled by them.
 func NewContext() *ErrGroupAndContext {
-	errGroup, ctx := errgroup.WithContext(signals.SetupSignalHandler())
+	errGroup, ctx := errgroup.WithContext(signalContext())
 
 	return &ErrGroupAndContext{
 		Ctx:      ctx,
@@ -32,3 +46,46 @@ func NewTestContext() *ErrGroupAndContext {
 		ErrGroup: errGroup,
 	}
 }
+
+// signalContext returns the context canceled by the signals of NewContext.
+// The handler of controller-runtime panics if it's set up more than once.
+func signalContext() context.Context {
+	signalOnce.Do(func() {
+		signalCtx = hangupContext(signals.SetupSignalHandler())
+	})
+
+	return signalCtx
+}
+
+// hangupContext is canceled by the first SIGHUP, which is sent when the terminal
+// or session that started the process goes away, so connections are drained
+// rather than dropped. Later ones have their default effect.
+func hangupContext(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		select {
+		case <-hangup:
+		case <-ctx.Done():
+		}
+		signal.Stop(hangup)
+		cancel()
+	}()
+
+	return ctx
+}
+
+// UpgradeSignal returns a channel that receives the signal asking the process
+// to hand its listeners off to a new process, SIGUSR2. The channel never
+// receives on platforms that don't support it.
+func UpgradeSignal() <-chan os.Signal {
+	upgrades := make(chan os.Signal, 1)
+	if len(upgradeSignals) > 0 {
+		signal.Notify(upgrades, upgradeSignals...)
+	}
+
+	return upgrades
+}
@@ -0,0 +1,12 @@
+//go:build linux
+// +build linux
+
+package context
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals are received by the channel of UpgradeSignal.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package context
+
+import (
+	"os"
+)
+
+// upgrades are only supported on Linux
+var upgradeSignals []os.Signal
@@ -0,0 +1,68 @@
+package cc
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/aserto-dev/go-utils/logger"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	cc_context "github.com/aserto-dev/go-sample-project/pkg/cc/context"
+)
+
+// Host is provided by programs that embed the service, see pkg/service.
+type Host struct {
+	// Context stops the service when it's done, it defaults to context.Background.
+	// Unlike NewCC, signals are left to the host
+	Context context.Context
+	// Logger is used instead of a logger created from the logging config
+	Logger *zerolog.Logger
+	// LogOutput and ErrOutput are written to by the logger created from the
+	// logging config, when Logger is nil. They default to stdout and stderr
+	LogOutput io.Writer
+	ErrOutput io.Writer
+}
+
+// NewHostedCC creates a CC for a service embedded in another program.
+// It applies the process wide settings, but leaves the standard library and
+// gRPC logs alone, the host can redirect them with RedirectGlobalLogs.
+func NewHostedCC(host Host, configPath config.Path, overrides config.Overrider) (*CC, func(), error) {
+	if err := setupProcess(); err != nil {
+		return nil, nil, err
+	}
+
+	return buildHostedCC(host, configPath, overrides)
+}
+
+func hostContext(host Host) *cc_context.ErrGroupAndContext {
+	ctx := host.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	errGroup, ctx := errgroup.WithContext(ctx)
+
+	return &cc_context.ErrGroupAndContext{
+		Ctx:      ctx,
+		ErrGroup: errGroup,
+	}
+}
+
+func hostLogger(host Host, cfg *logger.Config) (*zerolog.Logger, error) {
+	if host.Logger != nil {
+		return host.Logger, nil
+	}
+
+	var logOutput, errOutput io.Writer = os.Stdout, os.Stderr
+	if host.LogOutput != nil {
+		logOutput = host.LogOutput
+	}
+	if host.ErrOutput != nil {
+		errOutput = host.ErrOutput
+	}
+
+	return NewLogger(logOutput, errOutput, cfg)
+}
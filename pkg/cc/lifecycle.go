@@ -0,0 +1,249 @@
+package cc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Hook starts or stops a component.
+type Hook func(ctx context.Context) error
+
+// Component is a part of the application that is started and stopped by the Lifecycle.
+type Component struct {
+	// Name identifies the component in dependencies and logs
+	Name string
+	// DependsOn lists the components that are started before and stopped after this one
+	DependsOn []string
+	// Start and Stop are optional. Stop is only called after Start succeeded,
+	// so Start releases what it created when it fails.
+	Start Hook
+	Stop  Hook
+}
+
+// LifecycleState is the state of a Lifecycle.
+type LifecycleState int
+
+const (
+	// LifecycleIdle accepts new components, nothing was started yet
+	LifecycleIdle LifecycleState = iota
+	LifecycleStarting
+	LifecycleRunning
+	LifecycleStopping
+	// LifecycleStopped is final, the components can't be started again
+	LifecycleStopped
+)
+
+func (s LifecycleState) String() string {
+	switch s {
+	case LifecycleIdle:
+		return "idle"
+	case LifecycleStarting:
+		return "starting"
+	case LifecycleRunning:
+		return "running"
+	case LifecycleStopping:
+		return "stopping"
+	case LifecycleStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// Lifecycle starts components after their dependencies and stops them in
+// reverse order. If a component fails to start, the components that were
+// already started are stopped again. Stop can be called more than once, only
+// the first call stops the components.
+type Lifecycle struct {
+	logger *zerolog.Logger
+
+	// mu is held during transitions, so concurrent calls wait for each other
+	mu         sync.Mutex
+	state      LifecycleState
+	components []*Component
+	byName     map[string]*Component
+	// started are the components that were started, in order
+	started []*Component
+}
+
+// NewLifecycle creates a Lifecycle without components
+func NewLifecycle(log *zerolog.Logger) *Lifecycle {
+	lifecycleLogger := log.With().Str("component", "lifecycle").Logger()
+
+	return &Lifecycle{
+		logger: &lifecycleLogger,
+		byName: map[string]*Component{},
+	}
+}
+
+// State returns the current state.
+func (l *Lifecycle) State() LifecycleState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.state
+}
+
+// Register adds a component. Components can only be added before Start,
+// and their names must be unique.
+func (l *Lifecycle) Register(component Component) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.state != LifecycleIdle {
+		return errors.Errorf("can't register component '%s', lifecycle is %s", component.Name, l.state)
+	}
+
+	if _, ok := l.byName[component.Name]; ok {
+		return errors.Errorf("component '%s' is already registered", component.Name)
+	}
+
+	l.components = append(l.components, &component)
+	l.byName[component.Name] = &component
+
+	return nil
+}
+
+// Start starts all components after their dependencies. Components without
+// dependencies between them start in the order they were registered.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.state != LifecycleIdle {
+		return errors.Errorf("can't start, lifecycle is %s", l.state)
+	}
+
+	order, err := l.order()
+	if err != nil {
+		return err
+	}
+
+	l.state = LifecycleStarting
+	begin := time.Now()
+
+	for _, component := range order {
+		if err := l.run(ctx, component, component.Start, "started"); err != nil {
+			l.logger.Error().Err(err).Str("name", component.Name).Msg("failed to start component, rolling back")
+
+			if stopErr := l.stopStarted(ctx); stopErr != nil {
+				err = multierror.Append(err, stopErr)
+			}
+			l.state = LifecycleStopped
+
+			return errors.Wrapf(err, "failed to start '%s'", component.Name)
+		}
+		l.started = append(l.started, component)
+	}
+
+	l.state = LifecycleRunning
+	l.logger.Info().Dur("duration", time.Since(begin)).Msg("all components started")
+
+	return nil
+}
+
+// Stop stops the started components in the reverse order. Calls after the
+// first one don't do anything, and calls made while stopping wait for it to finish.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.state == LifecycleStopped {
+		return nil
+	}
+
+	l.state = LifecycleStopping
+	begin := time.Now()
+
+	err := l.stopStarted(ctx)
+
+	l.state = LifecycleStopped
+	l.logger.Info().Dur("duration", time.Since(begin)).Msg("all components stopped")
+
+	return err
+}
+
+// stopStarted stops all started components, even if some of them fail to stop.
+func (l *Lifecycle) stopStarted(ctx context.Context) error {
+	var result error
+
+	for i := len(l.started) - 1; i >= 0; i-- {
+		component := l.started[i]
+		if err := l.run(ctx, component, component.Stop, "stopped"); err != nil {
+			result = multierror.Append(result, errors.Wrapf(err, "failed to stop '%s'", component.Name))
+		}
+	}
+	l.started = nil
+
+	return result
+}
+
+// run calls the hook of a component and logs how long it took.
+func (l *Lifecycle) run(ctx context.Context, component *Component, hook Hook, phase string) error {
+	if hook == nil {
+		return nil
+	}
+
+	begin := time.Now()
+	err := hook(ctx)
+	if err != nil {
+		return err
+	}
+
+	l.logger.Debug().Str("name", component.Name).Dur("duration", time.Since(begin)).Msg("component " + phase)
+
+	return nil
+}
+
+// order sorts the components so that they come after their dependencies.
+func (l *Lifecycle) order() ([]*Component, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	marks := map[string]int{}
+	order := make([]*Component, 0, len(l.components))
+
+	var visit func(component *Component, path []string) error
+	visit = func(component *Component, path []string) error {
+		path = append(path, component.Name)
+
+		switch marks[component.Name] {
+		case visiting:
+			return errors.Errorf("dependency cycle: %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+
+		marks[component.Name] = visiting
+		for _, name := range component.DependsOn {
+			dependency, ok := l.byName[name]
+			if !ok {
+				return errors.Errorf("component '%s' depends on unknown component '%s'", component.Name, name)
+			}
+
+			if err := visit(dependency, path); err != nil {
+				return err
+			}
+		}
+		marks[component.Name] = visited
+		order = append(order, component)
+
+		return nil
+	}
+
+	for _, component := range l.components {
+		if err := visit(component, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
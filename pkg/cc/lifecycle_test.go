@@ -0,0 +1,94 @@
+package cc_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
+)
+
+// recorder records the hooks that were called, in order.
+type recorder []string
+
+func (r *recorder) component(name string, dependsOn ...string) cc.Component {
+	return cc.Component{
+		Name:      name,
+		DependsOn: dependsOn,
+		Start: func(context.Context) error {
+			*r = append(*r, "start "+name)
+			return nil
+		},
+		Stop: func(context.Context) error {
+			*r = append(*r, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func newLifecycle() *cc.Lifecycle {
+	log := zerolog.New(io.Discard)
+	return cc.NewLifecycle(&log)
+}
+
+func TestLifecycleOrder(t *testing.T) {
+	assert := require.New(t)
+	calls := recorder{}
+	l := newLifecycle()
+	assert.NoError(l.Register(calls.component("gateway", "grpc")))
+	assert.NoError(l.Register(calls.component("health")))
+	assert.NoError(l.Register(calls.component("grpc")))
+
+	assert.NoError(l.Start(context.Background()))
+	assert.Equal(cc.LifecycleRunning, l.State())
+	assert.NoError(l.Stop(context.Background()))
+	assert.NoError(l.Stop(context.Background()))
+
+	assert.Equal(cc.LifecycleStopped, l.State())
+	assert.Equal(recorder{
+		"start grpc", "start gateway", "start health",
+		"stop health", "stop gateway", "stop grpc",
+	}, calls)
+}
+
+func TestLifecycleRollback(t *testing.T) {
+	assert := require.New(t)
+	calls := recorder{}
+	l := newLifecycle()
+	assert.NoError(l.Register(calls.component("health")))
+	assert.NoError(l.Register(calls.component("grpc")))
+	assert.NoError(l.Register(cc.Component{
+		Name: "gateway",
+		Start: func(context.Context) error {
+			return errors.New("address in use")
+		},
+	}))
+
+	err := l.Start(context.Background())
+
+	assert.EqualError(err, "failed to start 'gateway': address in use")
+	assert.Equal(cc.LifecycleStopped, l.State())
+	assert.Equal(recorder{"start health", "start grpc", "stop grpc", "stop health"}, calls)
+	assert.Error(l.Start(context.Background()))
+}
+
+func TestLifecycleInvalidDependencies(t *testing.T) {
+	assert := require.New(t)
+	calls := recorder{}
+
+	cycle := newLifecycle()
+	assert.NoError(cycle.Register(calls.component("a", "b")))
+	assert.NoError(cycle.Register(calls.component("b", "a")))
+	assert.EqualError(cycle.Start(context.Background()), "dependency cycle: a -> b -> a")
+
+	unknown := newLifecycle()
+	assert.NoError(unknown.Register(calls.component("a", "missing")))
+	assert.EqualError(unknown.Start(context.Background()), "component 'a' depends on unknown component 'missing'")
+
+	assert.Error(unknown.Register(calls.component("a")))
+	assert.Empty(calls)
+}
@@ -0,0 +1,29 @@
+package cc
+
+import (
+	"github.com/aserto-dev/go-utils/logger"
+	"github.com/rs/zerolog"
+)
+
+// NewLogger creates the logger of a CC. Unlike logger.NewLogger from go-utils,
+// it doesn't change any global state, the log level only applies to this logger,
+// so several instances with different settings can run in the same process.
+// See SetupProcess for the settings that are global.
+func NewLogger(logOutput logger.Writer, errOutput logger.ErrWriter, cfg *logger.Config) (*zerolog.Logger, error) {
+	var log zerolog.Logger
+
+	if cfg.Prod {
+		log = zerolog.New(&logger.LevelWriter{
+			Writer:      logOutput,
+			ErrorWriter: errOutput,
+		})
+	} else {
+		cw := zerolog.NewConsoleWriter()
+		cw.Out = logOutput
+		log = zerolog.New(cw)
+	}
+
+	log = log.Level(cfg.LogLevelParsed).With().Timestamp().Logger()
+
+	return &log, nil
+}
@@ -1,10 +1,18 @@
 package metrics
 
 import (
+	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/slok/go-http-metrics/metrics"
 	"github.com/slok/go-http-metrics/metrics/prometheus"
 )
 
-func NewPrometheusRecorder() metrics.Recorder {
-	return prometheus.NewRecorder(prometheus.Config{})
+// NewRegistry creates the registry of an instance, so multiple instances
+// can be created in the same process.
+func NewRegistry() *prom.Registry {
+	return prom.NewRegistry()
+}
+
+// NewPrometheusRecorder creates a recorder backed by registry.
+func NewPrometheusRecorder(registry *prom.Registry) metrics.Recorder {
+	return prometheus.NewRecorder(prometheus.Config{Registry: registry})
 }
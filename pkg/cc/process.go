@@ -0,0 +1,62 @@
+package cc
+
+import (
+	"fmt"
+	stdlog "log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aserto-dev/go-utils/logger"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/pkgerrors"
+	"go.opencensus.io/plugin/ocgrpc"
+	"go.opencensus.io/stats/view"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/grpclog"
+)
+
+var (
+	processOnce sync.Once
+	processErr  error
+
+	redirectOnce sync.Once
+)
+
+// setupProcess applies the settings that are global to the process, the first
+// time a CC is created. They are the same for all instances.
+func setupProcess() error {
+	processOnce.Do(func() {
+		// Levels are set on every logger, see NewLogger
+		zerolog.SetGlobalLevel(zerolog.TraceLevel)
+		zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
+		zerolog.ErrorHandler = func(err error) {
+			if !strings.Contains(err.Error(), "file already closed") {
+				fmt.Fprintf(os.Stderr, "zerolog: could not write event: %v\n", err)
+			}
+		}
+
+		grpc.EnableTracing = true
+
+		if err := view.Register(ocgrpc.DefaultServerViews...); err != nil {
+			processErr = errors.Wrap(err, "failed to register ocgrpc server views")
+		}
+	})
+
+	return processErr
+}
+
+// RedirectGlobalLogs writes the output of the standard library logger and the
+// gRPC logger to log. Only the first call has an effect, so the logs of a
+// process go to a single place, even if it runs several instances. Binaries
+// that embed the service and have their own logging can call it before
+// creating any instance.
+func RedirectGlobalLogs(log *zerolog.Logger) {
+	redirectOnce.Do(func() {
+		stdLogger := log.With().Str("log-source", "std").Logger()
+		stdlog.SetOutput(logger.NewZerologWriter(&stdLogger))
+
+		grpclog.SetLoggerV2(logger.NewGRPCZeroLogger(log))
+	})
+}
@@ -0,0 +1,281 @@
+package cc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// RestartPolicy decides if a worker is restarted after it fails.
+type RestartPolicy int
+
+const (
+	// RestartNever leaves a failed worker stopped
+	RestartNever RestartPolicy = iota
+	// RestartOnFailure restarts a worker that returns an error or panics,
+	// with exponential backoff
+	RestartOnFailure
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+
+	// crashLoopFailures is the number of consecutive failures after which a
+	// worker is considered to be crash looping
+	crashLoopFailures = 3
+)
+
+// Worker is a background goroutine run by the Supervisor.
+type Worker struct {
+	// Name identifies the worker in logs, metrics and health checks
+	Name string
+	// Run should return when ctx is done
+	Run     func(ctx context.Context) error
+	Restart RestartPolicy
+	// MaxRestarts limits the number of restarts, 0 means unlimited
+	MaxRestarts int
+	// InitialBackoff is the delay before the first restart, defaults to 100ms.
+	// It doubles with every consecutive failure, up to MaxBackoff, 30s by default.
+	// A run that lasts longer than MaxBackoff resets it.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// WorkerState is the state of a supervised worker.
+type WorkerState int
+
+const (
+	WorkerRunning WorkerState = iota
+	// WorkerRestarting waits to restart the worker after it failed
+	WorkerRestarting
+	// WorkerCrashLooping waits to restart a worker that failed several times in a row
+	WorkerCrashLooping
+	// WorkerExited returned without an error, or was stopped by the supervisor
+	WorkerExited
+	// WorkerFailed isn't restarted anymore, because of its policy or MaxRestarts
+	WorkerFailed
+)
+
+func (s WorkerState) String() string {
+	switch s {
+	case WorkerRunning:
+		return "running"
+	case WorkerRestarting:
+		return "restarting"
+	case WorkerCrashLooping:
+		return "crash_looping"
+	case WorkerExited:
+		return "exited"
+	case WorkerFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Supervisor runs background workers alongside the ErrGroup. Unlike the ErrGroup,
+// a failing worker doesn't cancel the context of the application, it is restarted
+// according to its RestartPolicy.
+type Supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	logger *zerolog.Logger
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	states   map[string]WorkerState
+	watchers []func(name string, state WorkerState)
+
+	restarts     *prometheus.CounterVec
+	failures     *prometheus.CounterVec
+	up           *prometheus.GaugeVec
+	crashLooping *prometheus.GaugeVec
+}
+
+// NewSupervisor creates a Supervisor whose workers stop when ctx is done, or
+// when the returned cleanup function is called.
+func NewSupervisor(ctx context.Context, log *zerolog.Logger, registry *prometheus.Registry) (*Supervisor, func(), error) {
+	supervisorLogger := log.With().Str("component", "supervisor").Logger()
+	ctx, cancel := context.WithCancel(ctx)
+
+	s := &Supervisor{
+		ctx:    ctx,
+		cancel: cancel,
+		logger: &supervisorLogger,
+		states: map[string]WorkerState{},
+		restarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "supervisor_worker_restarts_total",
+			Help: "Number of times a worker was restarted.",
+		}, []string{"worker"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "supervisor_worker_failures_total",
+			Help: "Number of times a worker returned an error or panicked.",
+		}, []string{"worker"}),
+		up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "supervisor_worker_up",
+			Help: "Whether a worker is running.",
+		}, []string{"worker"}),
+		crashLooping: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "supervisor_worker_crash_looping",
+			Help: "Whether a worker failed several times in a row.",
+		}, []string{"worker"}),
+	}
+
+	for _, collector := range []prometheus.Collector{s.restarts, s.failures, s.up, s.crashLooping} {
+		if err := registry.Register(collector); err != nil {
+			cancel()
+			return nil, nil, errors.Wrap(err, "failed to register supervisor metrics")
+		}
+	}
+
+	return s, s.Stop, nil
+}
+
+// Go runs a worker in a new goroutine. Worker names must be unique, Go panics
+// if a worker with the same name was already started.
+func (s *Supervisor) Go(worker Worker) {
+	s.mu.Lock()
+	_, exists := s.states[worker.Name]
+	if !exists {
+		// reserves the name until setState reports the worker as running
+		s.states[worker.Name] = WorkerRunning
+	}
+	s.mu.Unlock()
+
+	if exists {
+		panic(errors.Errorf("duplicate worker name '%s'", worker.Name))
+	}
+
+	if worker.InitialBackoff == 0 {
+		worker.InitialBackoff = defaultInitialBackoff
+	}
+	if worker.MaxBackoff == 0 {
+		worker.MaxBackoff = defaultMaxBackoff
+	}
+
+	s.setState(worker.Name, WorkerRunning)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.supervise(&worker)
+	}()
+}
+
+// Stop stops all workers and waits for them to return.
+func (s *Supervisor) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// State returns the state of a worker, and false if there is no such worker.
+func (s *Supervisor) State(name string) (WorkerState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[name]
+
+	return state, ok
+}
+
+// Watch calls f with the current state of every worker, and then every time
+// the state of a worker changes. f must not block.
+func (s *Supervisor) Watch(f func(name string, state WorkerState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.watchers = append(s.watchers, f)
+	for name, state := range s.states {
+		f(name, state)
+	}
+}
+
+func (s *Supervisor) supervise(worker *Worker) {
+	log := s.logger.With().Str("worker", worker.Name).Logger()
+	backoff := worker.InitialBackoff
+	restarts, consecutiveFailures := 0, 0
+
+	for {
+		begin := time.Now()
+		err := s.run(worker)
+
+		if s.ctx.Err() != nil || err == nil {
+			log.Debug().Err(err).Msg("worker exited")
+			s.setState(worker.Name, WorkerExited)
+			return
+		}
+
+		s.failures.WithLabelValues(worker.Name).Inc()
+
+		if time.Since(begin) > worker.MaxBackoff {
+			// the worker was stable, this isn't part of a crash loop
+			backoff, consecutiveFailures = worker.InitialBackoff, 0
+		}
+		consecutiveFailures++
+
+		if worker.Restart == RestartNever || (worker.MaxRestarts > 0 && restarts >= worker.MaxRestarts) {
+			log.Error().Err(err).Int("restarts", restarts).Msg("worker failed, not restarting")
+			s.setState(worker.Name, WorkerFailed)
+			return
+		}
+
+		state := WorkerRestarting
+		if consecutiveFailures >= crashLoopFailures {
+			state = WorkerCrashLooping
+		}
+		log.Warn().Err(err).Dur("backoff", backoff).Stringer("state", state).Msg("worker failed, restarting")
+		s.setState(worker.Name, state)
+
+		select {
+		case <-s.ctx.Done():
+			s.setState(worker.Name, WorkerExited)
+			return
+		case <-time.After(backoff):
+		}
+
+		restarts++
+		s.restarts.WithLabelValues(worker.Name).Inc()
+		s.setState(worker.Name, WorkerRunning)
+
+		if backoff *= 2; backoff > worker.MaxBackoff {
+			backoff = worker.MaxBackoff
+		}
+	}
+}
+
+// run calls the worker, turning panics into errors.
+func (s *Supervisor) run(worker *Worker) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("worker panicked: %v", r)
+		}
+	}()
+
+	return worker.Run(s.ctx)
+}
+
+func (s *Supervisor) setState(name string, state WorkerState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[name] = state
+	s.up.WithLabelValues(name).Set(boolGauge(state == WorkerRunning))
+	s.crashLooping.WithLabelValues(name).Set(boolGauge(state == WorkerCrashLooping))
+
+	for _, f := range s.watchers {
+		f(name, state)
+	}
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,137 @@
+package cc_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
+)
+
+func newSupervisor(t *testing.T) (*cc.Supervisor, *prometheus.Registry) {
+	log := zerolog.New(io.Discard)
+	registry := prometheus.NewRegistry()
+
+	supervisor, cleanup, err := cc.NewSupervisor(context.Background(), &log, registry)
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+
+	return supervisor, registry
+}
+
+// watchStates sends the states of a worker to a channel.
+func watchStates(supervisor *cc.Supervisor, name string) <-chan cc.WorkerState {
+	states := make(chan cc.WorkerState, 100)
+	supervisor.Watch(func(worker string, state cc.WorkerState) {
+		if worker == name {
+			states <- state
+		}
+	})
+
+	return states
+}
+
+func waitForState(t *testing.T, states <-chan cc.WorkerState, expected cc.WorkerState) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case state := <-states:
+			if state == expected {
+				return
+			}
+		case <-timeout:
+			require.FailNow(t, "worker didn't reach state", "%s", expected)
+		}
+	}
+}
+
+func TestSupervisorCrashLoop(t *testing.T) {
+	assert := require.New(t)
+	supervisor, registry := newSupervisor(t)
+	states := watchStates(supervisor, "flaky")
+	runs := make(chan struct{}, 100)
+
+	supervisor.Go(cc.Worker{
+		Name:           "flaky",
+		Restart:        cc.RestartOnFailure,
+		MaxRestarts:    4,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			runs <- struct{}{}
+			if len(runs) == 2 {
+				panic("boom")
+			}
+			return errors.New("failed")
+		},
+	})
+
+	waitForState(t, states, cc.WorkerCrashLooping)
+	waitForState(t, states, cc.WorkerFailed)
+
+	assert.Len(runs, 5)
+	assert.Equal(4.0, counterValue(t, registry, "supervisor_worker_restarts_total"))
+	assert.Equal(5.0, counterValue(t, registry, "supervisor_worker_failures_total"))
+}
+
+func TestSupervisorStop(t *testing.T) {
+	assert := require.New(t)
+	supervisor, _ := newSupervisor(t)
+	states := watchStates(supervisor, "worker")
+
+	supervisor.Go(cc.Worker{
+		Name:    "worker",
+		Restart: cc.RestartOnFailure,
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	waitForState(t, states, cc.WorkerRunning)
+	supervisor.Stop()
+
+	state, ok := supervisor.State("worker")
+	assert.True(ok)
+	assert.Equal(cc.WorkerExited, state)
+}
+
+func TestSupervisorDuplicateWorker(t *testing.T) {
+	assert := require.New(t)
+	supervisor, _ := newSupervisor(t)
+	worker := cc.Worker{
+		Name: "worker",
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+	}
+
+	supervisor.Go(worker)
+
+	assert.PanicsWithError("duplicate worker name 'worker'", func() { supervisor.Go(worker) })
+}
+
+// counterValue returns the value of a counter in registry, summed over its labels.
+func counterValue(t *testing.T, registry *prometheus.Registry, name string) float64 {
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	value := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			value += metric.GetCounter().GetValue()
+		}
+	}
+
+	return value
+}
@@ -17,8 +17,11 @@ var (
 		cc_context.NewContext,
 		config.NewConfig,
 		config.NewLoggerConfig,
-		logger.NewLogger,
+		NewLogger,
+		metrics.NewRegistry,
 		metrics.NewPrometheusRecorder,
+		NewLifecycle,
+		NewSupervisor,
 		certs.NewGenerator,
 		wire.FieldsOf(new(config.Config), "Logging"),
 		wire.FieldsOf(new(*cc_context.ErrGroupAndContext), "Ctx", "ErrGroup"),
@@ -33,8 +36,29 @@ var (
 		// Normal
 		config.NewConfig,
 		config.NewLoggerConfig,
-		logger.NewLogger,
+		NewLogger,
+		metrics.NewRegistry,
 		metrics.NewPrometheusRecorder,
+		NewLifecycle,
+		NewSupervisor,
+		certs.NewGenerator,
+		wire.FieldsOf(new(*cc_context.ErrGroupAndContext), "Ctx", "ErrGroup"),
+
+		wire.Struct(new(CC), "*"),
+	)
+
+	ccHostedSet = wire.NewSet(
+		// Hosted
+		hostContext,
+		hostLogger,
+
+		// Normal
+		config.NewConfig,
+		config.NewLoggerConfig,
+		metrics.NewRegistry,
+		metrics.NewPrometheusRecorder,
+		NewLifecycle,
+		NewSupervisor,
 		certs.NewGenerator,
 		wire.FieldsOf(new(*cc_context.ErrGroupAndContext), "Ctx", "ErrGroup"),
 
@@ -63,3 +87,12 @@ func buildTestCC(
 	wire.Build(ccTestSet)
 	return &CC{}, func() {}, nil
 }
+
+func buildHostedCC(
+	host Host,
+	configPath config.Path,
+	overrides config.Overrider,
+) (*CC, func(), error) {
+	wire.Build(ccHostedSet)
+	return &CC{}, func() {}, nil
+}
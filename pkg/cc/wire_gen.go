@@ -26,7 +26,7 @@ func buildCC(logOutput logger.Writer, errOutput logger.ErrWriter, configPath con
 	if err != nil {
 		return nil, nil, err
 	}
-	zerologLogger, err := logger.NewLogger(logOutput, errOutput, loggerConfig)
+	zerologLogger, err := NewLogger(logOutput, errOutput, loggerConfig)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -36,15 +36,25 @@ func buildCC(logOutput logger.Writer, errOutput logger.ErrWriter, configPath con
 		return nil, nil, err
 	}
 	group := errGroupAndContext.ErrGroup
-	recorder := metrics.NewPrometheusRecorder()
-	ccCC := &CC{
+	registry := metrics.NewRegistry()
+	recorder := metrics.NewPrometheusRecorder(registry)
+	lifecycle := NewLifecycle(zerologLogger)
+	supervisor, cleanup, err := NewSupervisor(contextContext, zerologLogger, registry)
+	if err != nil {
+		return nil, nil, err
+	}
+	cc := &CC{
 		Context:         contextContext,
 		Config:          configConfig,
 		Log:             zerologLogger,
 		ErrGroup:        group,
+		MetricsRegistry: registry,
 		MetricsRecorder: recorder,
+		Lifecycle:       lifecycle,
+		Supervisor:      supervisor,
 	}
-	return ccCC, func() {
+	return cc, func() {
+		cleanup()
 	}, nil
 }
 
@@ -55,7 +65,46 @@ func buildTestCC(logOutput logger.Writer, errOutput logger.ErrWriter, configPath
 	if err != nil {
 		return nil, nil, err
 	}
-	zerologLogger, err := logger.NewLogger(logOutput, errOutput, loggerConfig)
+	zerologLogger, err := NewLogger(logOutput, errOutput, loggerConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	generator := certs.NewGenerator(zerologLogger)
+	configConfig, err := config.NewConfig(configPath, zerologLogger, overrides, generator)
+	if err != nil {
+		return nil, nil, err
+	}
+	group := errGroupAndContext.ErrGroup
+	registry := metrics.NewRegistry()
+	recorder := metrics.NewPrometheusRecorder(registry)
+	lifecycle := NewLifecycle(zerologLogger)
+	supervisor, cleanup, err := NewSupervisor(contextContext, zerologLogger, registry)
+	if err != nil {
+		return nil, nil, err
+	}
+	cc := &CC{
+		Context:         contextContext,
+		Config:          configConfig,
+		Log:             zerologLogger,
+		ErrGroup:        group,
+		MetricsRegistry: registry,
+		MetricsRecorder: recorder,
+		Lifecycle:       lifecycle,
+		Supervisor:      supervisor,
+	}
+	return cc, func() {
+		cleanup()
+	}, nil
+}
+
+func buildHostedCC(host Host, configPath config.Path, overrides config.Overrider) (*CC, func(), error) {
+	errGroupAndContext := hostContext(host)
+	contextContext := errGroupAndContext.Ctx
+	loggerConfig, err := config.NewLoggerConfig(configPath, overrides)
+	if err != nil {
+		return nil, nil, err
+	}
+	zerologLogger, err := hostLogger(host, loggerConfig)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -65,22 +114,43 @@ func buildTestCC(logOutput logger.Writer, errOutput logger.ErrWriter, configPath
 		return nil, nil, err
 	}
 	group := errGroupAndContext.ErrGroup
-	recorder := metrics.NewPrometheusRecorder()
-	ccCC := &CC{
+	registry := metrics.NewRegistry()
+	recorder := metrics.NewPrometheusRecorder(registry)
+	lifecycle := NewLifecycle(zerologLogger)
+	supervisor, cleanup, err := NewSupervisor(contextContext, zerologLogger, registry)
+	if err != nil {
+		return nil, nil, err
+	}
+	cc := &CC{
 		Context:         contextContext,
 		Config:          configConfig,
 		Log:             zerologLogger,
 		ErrGroup:        group,
+		MetricsRegistry: registry,
 		MetricsRecorder: recorder,
+		Lifecycle:       lifecycle,
+		Supervisor:      supervisor,
 	}
-	return ccCC, func() {
+	return cc, func() {
+		cleanup()
 	}, nil
 }
 
 // wire.go:
 
 var (
-	ccSet = wire.NewSet(context.NewContext, config.NewConfig, config.NewLoggerConfig, logger.NewLogger, metrics.NewPrometheusRecorder, certs.NewGenerator, wire.FieldsOf(new(config.Config), "Logging"), wire.FieldsOf(new(*context.ErrGroupAndContext), "Ctx", "ErrGroup"), wire.Struct(new(CC), "*"))
+	ccSet = wire.NewSet(context.NewContext, config.NewConfig, config.NewLoggerConfig, NewLogger, metrics.NewRegistry, metrics.NewPrometheusRecorder, NewLifecycle,
+		NewSupervisor, certs.NewGenerator, wire.FieldsOf(new(config.Config), "Logging"), wire.FieldsOf(new(*context.ErrGroupAndContext), "Ctx", "ErrGroup"), wire.Struct(new(CC), "*"),
+	)
+
+	ccTestSet = wire.NewSet(context.NewTestContext, config.NewConfig, config.NewLoggerConfig, NewLogger, metrics.NewRegistry, metrics.NewPrometheusRecorder, NewLifecycle,
+		NewSupervisor, certs.NewGenerator, wire.FieldsOf(new(*context.ErrGroupAndContext), "Ctx", "ErrGroup"), wire.Struct(new(CC), "*"),
+	)
+
+	ccHostedSet = wire.NewSet(
 
-	ccTestSet = wire.NewSet(context.NewTestContext, config.NewConfig, config.NewLoggerConfig, logger.NewLogger, metrics.NewPrometheusRecorder, certs.NewGenerator, wire.FieldsOf(new(*context.ErrGroupAndContext), "Ctx", "ErrGroup"), wire.Struct(new(CC), "*"))
+		hostContext,
+		hostLogger, config.NewConfig, config.NewLoggerConfig, metrics.NewRegistry, metrics.NewPrometheusRecorder, NewLifecycle,
+		NewSupervisor, certs.NewGenerator, wire.FieldsOf(new(*context.ErrGroupAndContext), "Ctx", "ErrGroup"), wire.Struct(new(CC), "*"),
+	)
 )
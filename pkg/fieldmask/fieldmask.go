@@ -0,0 +1,110 @@
+package fieldmask
+
+import (
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// tree is a set of field mask paths indexed by field name.
+// A nil subtree means the whole field is selected.
+type tree map[protoreflect.Name]tree
+
+// Parse splits the values of a fields.mask query parameter into field mask paths.
+// Both repeated parameters and comma separated lists are supported.
+func Parse(values []string) []string {
+	paths := []string{}
+	for _, value := range values {
+		for _, path := range strings.Split(value, ",") {
+			path = strings.TrimSpace(path)
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	return paths
+}
+
+// Validate returns an InvalidArgument error if any of the paths doesn't
+// exist in the message.
+func Validate(msg proto.Message, paths ...string) (*fieldmaskpb.FieldMask, error) {
+	mask, err := fieldmaskpb.New(msg, paths...)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid field mask: %s", err.Error())
+	}
+
+	mask.Normalize()
+
+	return mask, nil
+}
+
+// Project clears all fields of msg that are not covered by the given paths.
+// An empty list of paths leaves the message untouched.
+func Project(msg proto.Message, paths ...string) error {
+	if msg == nil || len(paths) == 0 {
+		return nil
+	}
+
+	mask, err := Validate(msg, paths...)
+	if err != nil {
+		return err
+	}
+
+	prune(msg.ProtoReflect(), newTree(mask.GetPaths()))
+
+	return nil
+}
+
+func newTree(paths []string) tree {
+	root := tree{}
+
+	for _, path := range paths {
+		node := root
+		fields := strings.Split(path, ".")
+		for i, field := range fields {
+			name := protoreflect.Name(field)
+			sub, ok := node[name]
+			if ok && sub == nil {
+				// a parent of this path is already fully selected
+				break
+			}
+
+			if i == len(fields)-1 {
+				node[name] = nil
+				break
+			}
+
+			if !ok {
+				sub = tree{}
+				node[name] = sub
+			}
+			node = sub
+		}
+	}
+
+	return root
+}
+
+func prune(msg protoreflect.Message, selected tree) {
+	cleared := []protoreflect.FieldDescriptor{}
+
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		sub, ok := selected[fd.Name()]
+		switch {
+		case !ok:
+			cleared = append(cleared, fd)
+		case sub != nil && fd.Message() != nil && !fd.IsList() && !fd.IsMap():
+			prune(v.Message(), sub)
+		}
+		return true
+	})
+
+	for _, fd := range cleared {
+		msg.Clear(fd)
+	}
+}
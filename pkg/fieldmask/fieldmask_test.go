@@ -0,0 +1,67 @@
+package fieldmask_test
+
+import (
+	"testing"
+
+	info "github.com/aserto-dev/go-grpc/aserto/common/info/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/aserto-dev/go-sample-project/pkg/fieldmask"
+)
+
+func newInfoResponse() *info.InfoResponse {
+	return &info.InfoResponse{
+		System:  &info.SystemInfo{InstanceId: "instance", CreatedAt: "now"},
+		Version: &info.VersionInfo{System: 1, Schema: "v1"},
+		Build: &info.BuildInfo{
+			Version: "1.0.0",
+			Commit:  "abc",
+			Os:      "linux",
+		},
+	}
+}
+
+func TestParse(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(
+		[]string{"build.version", "system", "version.schema"},
+		fieldmask.Parse([]string{"build.version, system", "", "version.schema,"}),
+	)
+}
+
+func TestProject(t *testing.T) {
+	assert := require.New(t)
+	msg := newInfoResponse()
+
+	err := fieldmask.Project(msg, "build.version", "system", "build")
+
+	assert.NoError(err)
+	assert.True(proto.Equal(&info.InfoResponse{
+		System: &info.SystemInfo{InstanceId: "instance", CreatedAt: "now"},
+		Build: &info.BuildInfo{
+			Version: "1.0.0",
+			Commit:  "abc",
+			Os:      "linux",
+		},
+	}, msg))
+
+	err = fieldmask.Project(msg, "build.os")
+
+	assert.NoError(err)
+	assert.True(proto.Equal(&info.InfoResponse{Build: &info.BuildInfo{Os: "linux"}}, msg))
+}
+
+func TestProjectInvalidPath(t *testing.T) {
+	assert := require.New(t)
+	msg := newInfoResponse()
+
+	err := fieldmask.Project(msg, "build.nope")
+
+	assert.Error(err)
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+	assert.True(proto.Equal(newInfoResponse(), msg))
+}
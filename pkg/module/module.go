@@ -0,0 +1,196 @@
+// Package module lets services plug into the application. A module registers
+// itself with Register, usually from the init function of its package, and is
+// created for every application whose config doesn't disable it.
+package module
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	"github.com/aserto-dev/go-sample-project/pkg/app/server"
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
+)
+
+// Module is a service of the application.
+type Module interface {
+	// Name is the key of the module in the config, modules.<name>. It must be lower case
+	Name() string
+	// Configure decodes the config section of the module, modules.<name>.config,
+	// into a struct with json tags. Unknown fields are errors
+	Configure(decode func(out interface{}) error) error
+	// RegisterGRPC registers the gRPC services of the module
+	RegisterGRPC(server *grpc.Server)
+	// GatewayHandlers are the gateway handlers of the gRPC services of the module
+	GatewayHandlers() server.HandlerRegistrations
+	// Check reports the health of the module as the health service module.<name>
+	Check(ctx context.Context) error
+	// Components are started before the servers and stopped after them. Their
+	// names should start with the name of the module
+	Components() []cc.Component
+	// Middleware is added to the servers
+	Middleware() server.Middleware
+}
+
+// Base implements Module, except for Name, without doing anything.
+// Modules embed it and override the methods they need.
+type Base struct{}
+
+func (Base) Configure(func(out interface{}) error) error { return nil }
+
+func (Base) RegisterGRPC(*grpc.Server) {}
+
+func (Base) GatewayHandlers() server.HandlerRegistrations { return nil }
+
+func (Base) Check(context.Context) error { return nil }
+
+func (Base) Components() []cc.Component { return nil }
+
+func (Base) Middleware() server.Middleware { return server.Middleware{} }
+
+// Factory creates a module for the application of c.
+type Factory func(c *cc.CC) (Module, error)
+
+// Modules are the enabled modules of an application.
+type Modules []Module
+
+var registry = struct {
+	sync.Mutex
+	factories map[string]Factory
+}{factories: map[string]Factory{}}
+
+// Register makes a module available to all applications in the process.
+// It panics if a module with the same name is already registered.
+func Register(name string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.factories[name]; ok {
+		panic("module '" + name + "' is already registered")
+	}
+
+	registry.factories[name] = factory
+}
+
+// Registered returns the names of the registered modules, sorted.
+func Registered() []string {
+	registry.Lock()
+	defer registry.Unlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Load creates and configures the modules that are enabled in the config of c,
+// sorted by name, and adds their components to its lifecycle.
+func Load(c *cc.CC) (Modules, error) {
+	names := Registered()
+
+	known := map[string]bool{}
+	for _, name := range names {
+		known[name] = true
+	}
+	for name := range c.Config.Modules {
+		if !known[name] {
+			return nil, errors.Errorf("unknown module '%s'", name)
+		}
+	}
+
+	modules := Modules{}
+	for _, name := range names {
+		if !c.Config.ModuleEnabled(name) {
+			c.Log.Info().Str("module", name).Msg("module disabled")
+			continue
+		}
+
+		registry.Lock()
+		factory := registry.factories[name]
+		registry.Unlock()
+
+		m, err := factory(c)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create module '%s'", name)
+		}
+
+		section := c.Config.Modules[name].Config
+		if err := m.Configure(func(out interface{}) error { return decode(section, out) }); err != nil {
+			return nil, errors.Wrapf(err, "failed to configure module '%s'", name)
+		}
+
+		for _, component := range m.Components() {
+			if err := c.Lifecycle.Register(component); err != nil {
+				return nil, errors.Wrapf(err, "failed to register components of module '%s'", name)
+			}
+		}
+
+		modules = append(modules, m)
+	}
+
+	return modules, nil
+}
+
+// decode converts the config section of a module to out, through JSON.
+func decode(section map[string]interface{}, out interface{}) error {
+	if section == nil {
+		return nil
+	}
+
+	buf, err := json.Marshal(section)
+	if err != nil {
+		return errors.Wrap(err, "invalid config")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.DisallowUnknownFields()
+
+	return errors.Wrap(decoder.Decode(out), "invalid config")
+}
+
+// Registrations registers the gRPC services of the modules.
+func (m Modules) Registrations() server.Registrations {
+	return func(s *grpc.Server) {
+		for _, module := range m {
+			module.RegisterGRPC(s)
+		}
+	}
+}
+
+// HandlerRegistrations returns the gateway handlers of the modules.
+func (m Modules) HandlerRegistrations() server.HandlerRegistrations {
+	registrations := server.HandlerRegistrations{}
+	for _, module := range m {
+		registrations = append(registrations, module.GatewayHandlers()...)
+	}
+
+	return registrations
+}
+
+// Middleware returns the middleware of the modules, in order.
+func (m Modules) Middleware() server.Middleware {
+	middleware := server.Middleware{}
+	for _, module := range m {
+		middleware = middleware.Append(module.Middleware())
+	}
+
+	return middleware
+}
+
+// HealthChecks returns the health checks of the modules, as module.<name>.
+func (m Modules) HealthChecks() server.HealthChecks {
+	checks := server.HealthChecks{}
+	for _, module := range m {
+		checks = append(checks, server.HealthCheck{Service: "module." + module.Name(), Check: module.Check})
+	}
+
+	return checks
+}
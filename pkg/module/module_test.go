@@ -0,0 +1,162 @@
+package module_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/aserto-dev/go-sample-project/pkg/app/server"
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	"github.com/aserto-dev/go-sample-project/pkg/module"
+)
+
+// the fake modules are registered for the whole test binary, tests disable
+// the ones they don't need
+func init() {
+	for _, name := range []string{"fake-b", "fake-a"} {
+		name := name
+		module.Register(name, func(*cc.CC) (module.Module, error) {
+			return &fakeModule{name: name}, nil
+		})
+	}
+}
+
+type fakeConfig struct {
+	Greeting string `json:"greeting"`
+}
+
+// fakeModule records the calls of its middleware and components in events.
+type fakeModule struct {
+	module.Base
+	name   string
+	config fakeConfig
+	events []string
+}
+
+func (m *fakeModule) Name() string {
+	return m.name
+}
+
+func (m *fakeModule) Configure(decode func(out interface{}) error) error {
+	return decode(&m.config)
+}
+
+func (m *fakeModule) Components() []cc.Component {
+	return []cc.Component{{
+		Name: m.name + ".worker",
+		Start: func(context.Context) error {
+			m.events = append(m.events, "start")
+			return nil
+		},
+		Stop: func(context.Context) error {
+			m.events = append(m.events, "stop")
+			return nil
+		},
+	}}
+}
+
+func (m *fakeModule) Middleware() server.Middleware {
+	return server.Middleware{
+		Unary: []grpc.UnaryServerInterceptor{
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				return handler(ctx, append(req.([]string), m.name))
+			},
+		},
+	}
+}
+
+func newCC(modules map[string]config.ModuleConfig) *cc.CC {
+	log := zerolog.New(io.Discard)
+
+	return &cc.CC{
+		Config:    &config.Config{Modules: modules},
+		Log:       &log,
+		Lifecycle: cc.NewLifecycle(&log),
+	}
+}
+
+func enabled(b bool) *bool {
+	return &b
+}
+
+func TestLoadUnknownModule(t *testing.T) {
+	assert := require.New(t)
+
+	_, err := module.Load(newCC(map[string]config.ModuleConfig{"nope": {}}))
+
+	assert.EqualError(err, "unknown module 'nope'")
+}
+
+func TestLoadDisabledModule(t *testing.T) {
+	assert := require.New(t)
+
+	modules, err := module.Load(newCC(map[string]config.ModuleConfig{"fake-a": {Enabled: enabled(false)}}))
+
+	assert.NoError(err)
+	assert.Len(modules, 1)
+	assert.Equal("fake-b", modules[0].Name())
+}
+
+func TestConfigure(t *testing.T) {
+	assert := require.New(t)
+
+	modules, err := module.Load(newCC(map[string]config.ModuleConfig{
+		"fake-a": {Config: map[string]interface{}{"greeting": "hello"}},
+		"fake-b": {Enabled: enabled(false)},
+	}))
+
+	assert.NoError(err)
+	assert.Len(modules, 1)
+	assert.Equal("hello", modules[0].(*fakeModule).config.Greeting)
+}
+
+func TestConfigureUnknownField(t *testing.T) {
+	assert := require.New(t)
+
+	_, err := module.Load(newCC(map[string]config.ModuleConfig{
+		"fake-a": {Config: map[string]interface{}{"greeting": "hello", "farewell": "bye"}},
+	}))
+
+	assert.Error(err)
+	assert.Contains(err.Error(), "failed to configure module 'fake-a'")
+	assert.Contains(err.Error(), `unknown field "farewell"`)
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	assert := require.New(t)
+	modules, err := module.Load(newCC(nil))
+	assert.NoError(err)
+
+	// chain the interceptors like the gRPC server does, the first one is the outermost
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return req, nil }
+	interceptors := modules.Middleware().Unary
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{}, next)
+		}
+	}
+	calls, err := handler(context.Background(), []string{})
+
+	assert.NoError(err)
+	assert.Equal([]string{"fake-a", "fake-b"}, calls)
+}
+
+func TestComponents(t *testing.T) {
+	assert := require.New(t)
+	c := newCC(map[string]config.ModuleConfig{"fake-b": {Enabled: enabled(false)}})
+
+	modules, err := module.Load(c)
+	assert.NoError(err)
+	fake := modules[0].(*fakeModule)
+
+	assert.NoError(c.Lifecycle.Start(context.Background()))
+	assert.Equal([]string{"start"}, fake.events)
+	assert.NoError(c.Lifecycle.Stop(context.Background()))
+	assert.Equal([]string{"start", "stop"}, fake.events)
+}
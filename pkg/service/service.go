@@ -0,0 +1,223 @@
+// Package service lets other Go programs embed the go-sample-project server.
+//
+//	svc, err := service.New(
+//		service.WithConfigFile("config.yaml"),
+//		service.WithLogger(&log),
+//		service.WithRegistrations(func(s *grpc.Server) { ... }),
+//	)
+//	if err != nil { ... }
+//	err = svc.Run(ctx)
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+
+	"github.com/aserto-dev/go-sample-project/pkg/app"
+	"github.com/aserto-dev/go-sample-project/pkg/app/server"
+	"github.com/aserto-dev/go-sample-project/pkg/cc"
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+)
+
+// Service is an embedded go-sample-project server.
+type Service struct {
+	app     *app.GoSampleProject
+	cleanup func()
+
+	stopOnce sync.Once
+	stopErr  error
+}
+
+// Option configures a Service.
+type Option func(*options)
+
+type options struct {
+	host       cc.Host
+	configPath config.Path
+	config     *config.Config
+	overrides  []config.Overrider
+	listeners  server.Listeners
+	extensions app.Extensions
+}
+
+// WithContext stops the service when ctx is done. Signals are left to the
+// embedding program.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.host.Context = ctx
+	}
+}
+
+// WithConfigFile reads the config from a YAML file. Without it, config.yaml is
+// read from the working directory if it exists.
+func WithConfigFile(path string) Option {
+	return func(o *options) {
+		o.configPath = config.Path(path)
+	}
+}
+
+// WithConfig applies cfg on top of the defaults and the config read from the file
+// and the environment. Only the fields of cfg that don't have their zero value are
+// used, so cfg doesn't need to repeat the defaults. Use WithConfigOverride to set
+// a field to its zero value. The result is validated, and certificates are
+// generated, as for a file. The service uses a copy of cfg, which isn't modified.
+func WithConfig(cfg *config.Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithConfigOverride changes the config after it's read. Overrides are
+// applied in order, after WithConfig.
+func WithConfigOverride(override func(*config.Config)) Option {
+	return func(o *options) {
+		o.overrides = append(o.overrides, override)
+	}
+}
+
+// WithLogger logs to log instead of a logger created from the logging config.
+func WithLogger(log *zerolog.Logger) Option {
+	return func(o *options) {
+		o.host.Logger = log
+	}
+}
+
+// WithLogOutput writes the logs to logOutput, and errors to errOutput,
+// instead of stdout and stderr. It's ignored when WithLogger is used.
+func WithLogOutput(logOutput, errOutput io.Writer) Option {
+	return func(o *options) {
+		o.host.LogOutput = logOutput
+		o.host.ErrOutput = errOutput
+	}
+}
+
+// WithListeners creates the listeners of the servers, e.g. to serve on
+// sockets opened by the embedding program.
+func WithListeners(listeners server.Listeners) Option {
+	return func(o *options) {
+		o.listeners = listeners
+	}
+}
+
+// WithRegistrations registers additional gRPC services.
+func WithRegistrations(registrations ...server.Registrations) Option {
+	return func(o *options) {
+		o.extensions.Registrations = append(o.extensions.Registrations, registrations...)
+	}
+}
+
+// WithGatewayHandlers registers the gateway handlers of additional gRPC services.
+func WithGatewayHandlers(registrations ...server.HandlerRegistration) Option {
+	return func(o *options) {
+		o.extensions.HandlerRegistrations = append(o.extensions.HandlerRegistrations, registrations...)
+	}
+}
+
+// WithUnaryInterceptors adds interceptors to the unary calls of the gRPC server.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(o *options) {
+		o.extensions.Middleware.Unary = append(o.extensions.Middleware.Unary, interceptors...)
+	}
+}
+
+// WithStreamInterceptors adds interceptors to the streaming calls of the gRPC server.
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(o *options) {
+		o.extensions.Middleware.Stream = append(o.extensions.Middleware.Stream, interceptors...)
+	}
+}
+
+// WithHTTPMiddleware wraps the handlers of the gateway and gRPC-Web servers.
+// The first middleware is the outermost.
+func WithHTTPMiddleware(middleware ...func(http.Handler) http.Handler) Option {
+	return func(o *options) {
+		o.extensions.Middleware.HTTP = append(o.extensions.Middleware.HTTP, middleware...)
+	}
+}
+
+// New creates a service. It doesn't listen until Start is called.
+func New(opts ...Option) (*Service, error) {
+	o := options{listeners: server.TCPListeners()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	overrides := func(cfg *config.Config) {
+		if o.config != nil {
+			// the config of the caller isn't modified by overrides and validation
+			cfg.Merge(o.config)
+		}
+
+		for _, override := range o.overrides {
+			override(cfg)
+		}
+	}
+
+	gsp, cleanup, err := app.BuildHostedGoSampleProject(o.host, o.configPath, overrides, o.listeners, &o.extensions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build service")
+	}
+
+	return &Service{app: gsp, cleanup: cleanup}, nil
+}
+
+// Config returns the config of the service, after overrides and validation.
+func (s *Service) Config() *config.Config {
+	return s.app.Configuration
+}
+
+// Logger returns the logger of the service.
+func (s *Service) Logger() *zerolog.Logger {
+	return s.app.Logger
+}
+
+// MetricsRegistry returns the registry of the metrics of the service, which the
+// gateway serves on /metrics. The embedding program can register its own
+// metrics with it, or gather them to serve them elsewhere.
+func (s *Service) MetricsRegistry() *prometheus.Registry {
+	return s.app.Server.MetricsRegistry
+}
+
+// Context is done when the context of WithContext is, or when a server fails.
+func (s *Service) Context() context.Context {
+	return s.app.Context
+}
+
+// Start starts the servers. If one of them fails to start, the ones that were
+// already started are stopped.
+func (s *Service) Start() error {
+	return s.app.Server.Start()
+}
+
+// Stop stops the servers and releases the resources of the service.
+// It can be called more than once.
+func (s *Service) Stop() error {
+	s.stopOnce.Do(func() {
+		s.stopErr = s.app.Server.Stop()
+		s.cleanup()
+	})
+
+	return s.stopErr
+}
+
+// Run starts the service, and stops it when ctx or the context of the service is done.
+func (s *Service) Run(ctx context.Context) error {
+	if err := s.Start(); err != nil {
+		_ = s.Stop()
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-s.Context().Done():
+	}
+
+	return s.Stop()
+}
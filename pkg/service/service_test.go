@@ -0,0 +1,348 @@
+package service_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	info "github.com/aserto-dev/go-grpc/aserto/common/info/v1"
+	"github.com/aserto-dev/go-utils/certs"
+	"github.com/aserto-dev/go-utils/testutil"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/aserto-dev/go-sample-project/pkg/app/server"
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+	"github.com/aserto-dev/go-sample-project/pkg/service"
+	"github.com/aserto-dev/go-sample-project/pkg/testharness"
+)
+
+// embedded is a service whose servers listen on free ports.
+type embedded struct {
+	t   *testing.T
+	dir string
+
+	mu        sync.Mutex
+	addresses map[string]string
+}
+
+func newEmbedded(t *testing.T) *embedded {
+	return &embedded{t: t, dir: t.TempDir(), addresses: map[string]string{}}
+}
+
+// options are the options of a service whose certificates are generated in a
+// temporary directory.
+func (e *embedded) options() []service.Option {
+	log := zerolog.New(zerolog.SyncWriter(testutil.NewLogDebugger(e.t, "service")))
+
+	return []service.Option{
+		service.WithConfigOverride(e.setCerts),
+		service.WithLogger(&log),
+		service.WithListeners(func(name, _ string) (net.Listener, error) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err == nil {
+				e.mu.Lock()
+				e.addresses[name] = lis.Addr().String()
+				e.mu.Unlock()
+			}
+			return lis, err
+		}),
+	}
+}
+
+func (e *embedded) setCerts(cfg *config.Config) {
+	cfg.API.GRPC.Certs = certs.TLSCredsConfig{
+		TLSKeyPath:    filepath.Join(e.dir, "grpc.key"),
+		TLSCertPath:   filepath.Join(e.dir, "grpc.crt"),
+		TLSCACertPath: filepath.Join(e.dir, "grpc-ca.crt"),
+	}
+	cfg.API.Gateway.Certs = certs.TLSCredsConfig{
+		TLSKeyPath:    filepath.Join(e.dir, "gateway.key"),
+		TLSCertPath:   filepath.Join(e.dir, "gateway.crt"),
+		TLSCACertPath: filepath.Join(e.dir, "gateway-ca.crt"),
+	}
+}
+
+// get calls the gateway of svc, which must be started.
+func (e *embedded) get(svc *service.Service, path string) (*http.Response, []byte) {
+	assert := require.New(e.t)
+
+	caCert, err := os.ReadFile(svc.Config().API.Gateway.Certs.TLSCACertPath)
+	assert.NoError(err)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caCert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}}
+	defer client.CloseIdleConnections()
+
+	e.mu.Lock()
+	gatewayAddress := e.addresses[server.ListenerGateway]
+	e.mu.Unlock()
+
+	resp, err := client.Get("https://" + gatewayAddress + path)
+	assert.NoError(err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(err)
+
+	return resp, body
+}
+
+func TestEmbeddedService(t *testing.T) {
+	assert := require.New(t)
+	e := newEmbedded(t)
+	var unaryCalls int32
+
+	svc, err := service.New(append(e.options(),
+		service.WithConfigFile(string(testharness.AssetDefaultConfig())),
+		service.WithUnaryInterceptors(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			atomic.AddInt32(&unaryCalls, 1)
+			return handler(ctx, req)
+		}),
+		service.WithHTTPMiddleware(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Embedded", "true")
+				next.ServeHTTP(w, r)
+			})
+		}),
+	)...)
+	assert.NoError(err)
+	assert.NoError(svc.Start())
+	defer func() { assert.NoError(svc.Stop()) }()
+
+	resp, _ := e.get(svc, "/api/v1/info")
+
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("true", resp.Header.Get("X-Embedded"))
+	assert.Equal(int32(1), atomic.LoadInt32(&unaryCalls))
+
+	embeddedTotal := prometheus.NewCounter(prometheus.CounterOpts{Name: "embedded_total"})
+	embeddedTotal.Inc()
+	assert.NoError(svc.MetricsRegistry().Register(embeddedTotal))
+
+	metrics, body := e.get(svc, "/metrics")
+
+	assert.Equal(http.StatusOK, metrics.StatusCode)
+	assert.Contains(string(body), "embedded_total 1")
+	assert.NoError(svc.Stop())
+}
+
+func TestEmbeddedServiceWithConfig(t *testing.T) {
+	assert := require.New(t)
+	e := newEmbedded(t)
+
+	// only the fields that differ from the defaults are set
+	cfg := &config.Config{}
+	enabled := true
+	cfg.Modules = map[string]config.ModuleConfig{"info": {Enabled: &enabled}}
+	cfg.API.Gateway.Upstreams = map[string]config.UpstreamConfig{
+		"remote": {Address: "127.0.0.1:1", Services: []string{"remote.v1.Remote"}},
+	}
+	cfg.API.GRPC.ListenAddress = "127.0.0.1:1234"
+
+	svc, err := service.New(append(e.options(), service.WithConfig(cfg))...)
+	assert.NoError(err)
+	defer func() { assert.NoError(svc.Stop()) }()
+
+	actual := svc.Config()
+	assert.Equal("127.0.0.1:1234", actual.API.GRPC.ListenAddress)
+	assert.Equal("0.0.0.0:8383", actual.API.Gateway.ListenAddress)
+	assert.Equal(config.UpstreamInProcess, actual.API.Gateway.Upstream.Mode)
+	assert.Equal(filepath.Join(e.dir, "grpc.crt"), actual.API.GRPC.Certs.TLSCertPath)
+	assert.FileExists(actual.API.GRPC.Certs.TLSCertPath)
+	assert.Equal(config.UpstreamRemote, actual.API.Gateway.Upstreams["remote"].Mode)
+
+	// the service has its own copy of the config
+	actual.Modules["other"] = config.ModuleConfig{}
+	*actual.Modules["info"].Enabled = false
+	actual.API.Gateway.Upstreams["remote"].Services[0] = "changed"
+
+	assert.NotContains(cfg.Modules, "other")
+	assert.True(*cfg.Modules["info"].Enabled)
+	assert.Empty(cfg.API.Gateway.Upstreams["remote"].Mode)
+	assert.Equal("remote.v1.Remote", cfg.API.Gateway.Upstreams["remote"].Services[0])
+	assert.NotEqual(filepath.Join(e.dir, "grpc.crt"), cfg.API.GRPC.Certs.TLSCertPath)
+}
+
+func TestEmbeddedServiceInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		override func(cfg *config.Config)
+		err      string
+	}{
+		{
+			name: "gateway role with in-process upstream",
+			override: func(cfg *config.Config) {
+				cfg.API.Role = config.RoleGateway
+				cfg.API.Gateway.Upstream.Mode = config.UpstreamInProcess
+			},
+			err: "the gateway role has no gRPC server",
+		},
+		{
+			name: "retries without backoff",
+			override: func(cfg *config.Config) {
+				cfg.API.Gateway.Upstream.Retry.InitialBackoffMs = 0
+			},
+			err: "initial_backoff_ms and max_backoff_ms must be positive",
+		},
+		{
+			name: "retries without backoff multiplier",
+			override: func(cfg *config.Config) {
+				cfg.API.Gateway.Upstream.Retry.BackoffMultiplier = 0
+			},
+			err: "backoff_multiplier must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := require.New(t)
+			e := newEmbedded(t)
+
+			_, err := service.New(append(e.options(), service.WithConfigOverride(tt.override))...)
+
+			assert.Error(err)
+			assert.Contains(err.Error(), tt.err)
+		})
+	}
+}
+
+func TestEmbeddedServiceRun(t *testing.T) {
+	assert := require.New(t)
+	e := newEmbedded(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	svc, err := service.New(append(e.options(),
+		service.WithConfigFile(string(testharness.AssetDefaultConfig())),
+		service.WithContext(ctx),
+	)...)
+	assert.NoError(err)
+
+	done := make(chan error, 1)
+	go func() { done <- svc.Run(context.Background()) }()
+
+	assert.Eventually(func() bool {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		return e.addresses[server.ListenerGateway] != ""
+	}, 10*time.Second, 10*time.Millisecond)
+	resp, _ := e.get(svc, "/api/v1/info")
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	// the context of WithContext stops the service
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(err)
+	case <-time.After(10 * time.Second):
+		assert.FailNow("service didn't stop")
+	}
+	assert.Error(svc.Context().Err())
+}
+
+// fakeInfo replaces the info API of the info module.
+type fakeInfo struct{}
+
+func (fakeInfo) Info(context.Context, *info.InfoRequest) (*info.InfoResponse, error) {
+	return &info.InfoResponse{Build: &info.BuildInfo{Version: "embedded"}}, nil
+}
+
+func TestEmbeddedServiceRegistrations(t *testing.T) {
+	assert := require.New(t)
+	e := newEmbedded(t)
+	disabled := false
+
+	svc, err := service.New(append(e.options(),
+		service.WithConfigFile(string(testharness.AssetDefaultConfig())),
+		service.WithConfigOverride(func(cfg *config.Config) {
+			cfg.Modules = map[string]config.ModuleConfig{"info": {Enabled: &disabled}}
+		}),
+		service.WithRegistrations(func(s *grpc.Server) {
+			info.RegisterInfoServer(s, fakeInfo{})
+		}),
+		service.WithGatewayHandlers(server.HandlerRegistration{
+			Service:  info.Info_ServiceDesc.ServiceName,
+			Register: info.RegisterInfoHandler,
+		}),
+	)...)
+	assert.NoError(err)
+	assert.NoError(svc.Start())
+	defer func() { assert.NoError(svc.Stop()) }()
+
+	resp, body := e.get(svc, "/api/v1/info")
+
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	var result struct {
+		Build struct {
+			Version string `json:"version"`
+		} `json:"build"`
+	}
+	assert.NoError(json.Unmarshal(body, &result))
+	assert.Equal("embedded", result.Build.Version)
+}
+
+// sharedInfo returns the same response to every call, like a handler that caches it.
+type sharedInfo struct {
+	resp *info.InfoResponse
+}
+
+func (s sharedInfo) Info(context.Context, *info.InfoRequest) (*info.InfoResponse, error) {
+	return s.resp, nil
+}
+
+func TestEmbeddedServiceFieldsMaskSharedResponse(t *testing.T) {
+	assert := require.New(t)
+	e := newEmbedded(t)
+	disabled := false
+	shared := sharedInfo{resp: &info.InfoResponse{Build: &info.BuildInfo{Version: "embedded", Commit: "abc"}}}
+
+	svc, err := service.New(append(e.options(),
+		service.WithConfigFile(string(testharness.AssetDefaultConfig())),
+		service.WithConfigOverride(func(cfg *config.Config) {
+			cfg.Modules = map[string]config.ModuleConfig{"info": {Enabled: &disabled}}
+		}),
+		// the gateway calls the handler directly, and gets its response
+		service.WithGatewayHandlers(server.HandlerRegistration{
+			Service: info.Info_ServiceDesc.ServiceName,
+			Register: func(ctx context.Context, mux *runtime.ServeMux, _ *grpc.ClientConn) error {
+				return info.RegisterInfoHandlerServer(ctx, mux, shared)
+			},
+		}),
+	)...)
+	assert.NoError(err)
+	assert.NoError(svc.Start())
+	defer func() { assert.NoError(svc.Stop()) }()
+
+	masked, maskedBody := e.get(svc, "/api/v1/info?fields.mask=build.version")
+	full, fullBody := e.get(svc, "/api/v1/info")
+
+	assert.Equal(http.StatusOK, masked.StatusCode)
+	assert.JSONEq(`{"build": {"version": "embedded"}}`, string(maskedBody))
+	assert.Equal(http.StatusOK, full.StatusCode)
+	var result struct {
+		Build struct {
+			Commit string `json:"commit"`
+		} `json:"build"`
+	}
+	assert.NoError(json.Unmarshal(fullBody, &result))
+	assert.Equal("abc", result.Build.Commit)
+	assert.Equal("abc", shared.resp.Build.Commit)
+}
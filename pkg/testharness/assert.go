@@ -0,0 +1,53 @@
+package testharness
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorEnvelope is the JSON body returned by the gateway for all errors.
+type ErrorEnvelope struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	RequestID string            `json:"request_id"`
+	Details   []json.RawMessage `json:"details"`
+}
+
+// AssertGRPCCode fails the test unless err carries the gRPC status code c.
+// It returns the status for further assertions.
+func AssertGRPCCode(t testing.TB, err error, c codes.Code) *status.Status {
+	assert := require.New(t)
+
+	assert.Error(err)
+	st, ok := status.FromError(err)
+	assert.True(ok, "not a gRPC status: %v", err)
+	assert.Equal(c, st.Code(), "unexpected status %v", st)
+
+	return st
+}
+
+// AssertErrorEnvelope fails the test unless resp is an error envelope with the
+// gRPC status code c and the HTTP status matching it.
+// It returns the envelope for further assertions.
+func AssertErrorEnvelope(t testing.TB, resp *http.Response, c codes.Code) ErrorEnvelope {
+	assert := require.New(t)
+
+	assert.Equal(runtime.HTTPStatusFromCode(c), resp.StatusCode)
+	assert.Equal("application/json", resp.Header.Get("Content-Type"))
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.DisallowUnknownFields()
+
+	var envelope ErrorEnvelope
+	assert.NoError(decoder.Decode(&envelope))
+	assert.Equal(code.Code(c).String(), envelope.Code)
+
+	return envelope
+}
@@ -18,3 +18,8 @@ func AssetsDir() string {
 func AssetDefaultConfig() config.Path {
 	return config.Path(filepath.Join(AssetsDir(), "config.yaml"))
 }
+
+// moduleDir returns the root directory of the module
+func moduleDir() string {
+	return filepath.Join(AssetsDir(), "..", "..", "..")
+}
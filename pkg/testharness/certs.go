@@ -0,0 +1,61 @@
+package testharness
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// certFiles are the names of the certificates generated by the application.
+var certFiles = []string{
+	"grpc.key", "grpc.crt", "grpc-ca.crt",
+	"gateway.key", "gateway.crt", "gateway-ca.crt",
+}
+
+// devCerts keeps the certificates generated by the first harness, so the
+// following ones don't spend seconds generating RSA keys.
+var devCerts struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// restoreCerts writes the certificates generated by a previous harness to dir.
+// It does nothing until a harness has generated certificates.
+func restoreCerts(dir string) error {
+	devCerts.mu.Lock()
+	defer devCerts.mu.Unlock()
+
+	for name, content := range devCerts.files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o600); err != nil {
+			return errors.Wrapf(err, "failed to write certificate '%s'", name)
+		}
+	}
+
+	return nil
+}
+
+// saveCerts keeps the certificates generated in dir for the following harnesses.
+func saveCerts(dir string) error {
+	devCerts.mu.Lock()
+	defer devCerts.mu.Unlock()
+
+	if devCerts.files != nil {
+		return nil
+	}
+
+	files := map[string][]byte{}
+	for _, name := range certFiles {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return errors.Wrapf(err, "failed to read certificate '%s'", name)
+		}
+
+		files[name] = content
+	}
+
+	devCerts.files = files
+
+	return nil
+}
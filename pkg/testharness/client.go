@@ -1,27 +1,69 @@
 package testharness
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"log"
+	"net"
 	"net/http"
 	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
-// CreateClient creates a new http client that can talk to the API
-func (h *TestHarness) CreateClient() *http.Client {
+// CreateClient creates a new http client that can talk to the API.
+// Errors fail t, which is the test or subtest that calls it.
+func (h *TestHarness) CreateClient(t testing.TB) *http.Client {
 	caCert, err := os.ReadFile(h.GoSampleProject.Configuration.API.Gateway.Certs.TLSCACertPath)
-	if err != nil {
-		log.Fatal(err)
-	}
+	require.NoError(t, err)
 	caCertPool := x509.NewCertPool()
 	caCertPool.AppendCertsFromPEM(caCert)
 	client := &http.Client{
 		Transport: &http.Transport{
+			DialContext: h.DialContext,
 			TLSClientConfig: &tls.Config{
-				RootCAs: caCertPool,
+				RootCAs:    caCertPool,
 				MinVersion: tls.VersionTLS12,
-		}}}
+			}}}
 
 	return client
 }
+
+// CreateGRPCConn creates a new connection to the gRPC server that trusts the
+// generated gRPC CA. The connection is closed by Cleanup.
+// Errors fail t, which is the test or subtest that calls it.
+func (h *TestHarness) CreateGRPCConn(t testing.TB, opts ...grpc.DialOption) *grpc.ClientConn {
+	creds, err := credentials.NewClientTLSFromFile(h.GoSampleProject.Configuration.API.GRPC.Certs.TLSCACertPath, "")
+	require.NoError(t, err)
+
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return h.DialContext(ctx, "tcp", address)
+		}),
+	}, opts...)
+
+	conn, err := grpc.Dial(h.GRPCAddress, opts...)
+	require.NoError(t, err)
+
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+	h.grpcConns = append(h.grpcConns, conn)
+
+	return conn
+}
+
+// GRPCConn returns a connection to the gRPC server shared by all callers,
+// which is closed by Cleanup. It's created by the first call, whose t fails
+// if it can't be created.
+func (h *TestHarness) GRPCConn(t testing.TB) *grpc.ClientConn {
+	h.grpcConnOnce.Do(func() {
+		h.grpcConn = h.CreateGRPCConn(t)
+	})
+	require.NotNil(t, h.grpcConn, "the shared gRPC connection couldn't be created")
+
+	return h.grpcConn
+}
@@ -0,0 +1,130 @@
+package testharness
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// flagUpdate is registered with the flags of the test binaries that import the
+// harness, e.g. go test ./pkg/app -update. Packages that don't import it don't
+// accept the flag, so it can't be passed to go test ./...
+var flagUpdate = flag.Bool("update", false, "Update the golden files instead of comparing responses with them")
+
+// volatilePaths are the fields whose values change between builds, machines
+// or calls. They are replaced in golden files.
+var volatilePaths = []string{"build.date", "build.os", "build.arch", "system.instance_id", "request_id"}
+
+const volatileValue = "<volatile>"
+
+var timestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?$`)
+
+// GoldenPath returns the path of a golden file in the testdata directory.
+func GoldenPath(name string) string {
+	return filepath.Join(AssetsDir(), "golden", name+".json")
+}
+
+// AssertGolden fails the test unless the JSON body matches the golden file
+// with the given name. Volatile fields, timestamps and the additional paths
+// are normalized first. With the -update flag, the golden file is written instead.
+func AssertGolden(t testing.TB, name string, body []byte, volatile ...string) {
+	require.NoError(t, compareGolden(name, body, volatile...))
+}
+
+// AssertGoldenProto is AssertGolden for a message, rendered like the gateway renders responses.
+func AssertGoldenProto(t testing.TB, name string, msg proto.Message, volatile ...string) {
+	body, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(msg)
+	require.NoError(t, err)
+
+	AssertGolden(t, name, body, volatile...)
+}
+
+func compareGolden(name string, body []byte, volatile ...string) error {
+	paths := append(append([]string{}, volatilePaths...), volatile...)
+
+	actual, err := normalizeGolden(body, paths)
+	if err != nil {
+		return err
+	}
+
+	path := GoldenPath(name)
+	if *flagUpdate {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return errors.Wrap(err, "failed to create golden files directory")
+		}
+
+		return errors.Wrapf(os.WriteFile(path, actual, 0o600), "failed to write golden file '%s'", path)
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read golden file '%s', run the tests with -update to create it", path)
+	}
+
+	if bytes.Equal(expected, actual) {
+		return nil
+	}
+
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(expected)),
+		B:        difflib.SplitLines(string(actual)),
+		FromFile: path,
+		ToFile:   "response",
+		Context:  3,
+	})
+
+	return errors.Errorf("response doesn't match golden file, run the tests with -update to accept it:\n%s", diff)
+}
+
+// normalizeGolden formats body as indented JSON with sorted keys, replacing
+// the values at the volatile paths and timestamps.
+func normalizeGolden(body []byte, volatile []string) ([]byte, error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, errors.Wrapf(err, "body is not JSON: %s", body)
+	}
+
+	value = normalizeTimestamps(value)
+	for _, path := range volatile {
+		replaceJSONPath(value, path, volatileValue)
+	}
+
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return nil, errors.Wrap(err, "failed to encode normalized body")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func normalizeTimestamps(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			v[key] = normalizeTimestamps(field)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeTimestamps(v[i])
+		}
+	case string:
+		if timestampPattern.MatchString(v) {
+			return volatileValue
+		}
+	}
+
+	return value
+}
@@ -1,62 +1,218 @@
 package testharness
 
 import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aserto-dev/go-utils/certs"
 	"github.com/aserto-dev/go-utils/testutil"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
 
 	"github.com/aserto-dev/go-sample-project/pkg/app"
+	"github.com/aserto-dev/go-sample-project/pkg/app/server"
 	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
 )
 
 // TestHarness wraps a GoSampleProject so we can set it up easily
 // and monitor its logs
 type TestHarness struct {
-	GoSampleProject       *app.GoSampleProject
+	GoSampleProject *app.GoSampleProject
+	// LogDebugger is nil when the harness is used by a benchmark
 	LogDebugger *testutil.LogDebugger
 
-	cleanup      func()
-	t            *testing.T
+	// Addresses the servers can be reached at, GRPCWebAddress is empty
+	// unless gRPC-Web is configured with its own listener
+	GRPCAddress    string
+	GatewayAddress string
+	HealthAddress  string
+	GRPCWebAddress string
+
+	cleanup func()
+	t       testing.TB
+	// logCapture provides the log assertions of the harness
+	*logCapture
+	// id is the value of the goroutine label of the harness
+	id string
+
+	// memory is nil unless the harness was created WithInMemory
+	memory *memoryListeners
+
+	// the clients can be created from parallel subtests, which pass their own
+	// testing.TB, as only the goroutine of a test can fail it
+	clientsMu      sync.Mutex
+	grpcConnOnce   sync.Once
+	grpcConn       *grpc.ClientConn
+	grpcConns      []*grpc.ClientConn
+	restClientOnce sync.Once
+	restClient     *http.Client
 }
 
 // Cleanup cleans up the application, releasing all resources
+// The test fails if goroutines started by the application are still running
+// afterwards. Only the goroutines started by Setup and Cleanup are checked, see
+// goroutineLabel.
 func (h *TestHarness) Cleanup() {
 	assert := require.New(h.t)
-	assert.NoError(h.GoSampleProject.Server.Stop())
-
-	// Cleanup the app
-	h.cleanup()
-
-	assert.Eventually(func() bool {
-		return !testutil.PortOpen("127.0.0.1:8484")
-	}, 10*time.Second, 10*time.Millisecond)
-	assert.Eventually(func() bool {
-		return !testutil.PortOpen("127.0.0.1:8383")
-	}, 10*time.Second, 10*time.Millisecond)
-	assert.Eventually(func() bool {
-		return !testutil.PortOpen("127.0.0.1:8282")
-	}, 10*time.Second, 10*time.Millisecond)
+
+	h.clientsMu.Lock()
+	for _, conn := range h.grpcConns {
+		assert.NoError(conn.Close())
+	}
+	h.clientsMu.Unlock()
+
+	h.labeled(func() {
+		assert.NoError(h.GoSampleProject.Server.Stop())
+
+		// Cleanup the app
+		h.cleanup()
+	})
+
+	if h.memory != nil {
+		assert.Empty(h.memory.open(), "in-memory listeners are still open")
+	} else {
+		for _, address := range []string{h.HealthAddress, h.GatewayAddress, h.GRPCAddress, h.GRPCWebAddress} {
+			if address == "" {
+				continue
+			}
+
+			assert.Eventually(func() bool {
+				return !testutil.PortOpen(address)
+			}, 10*time.Second, 10*time.Millisecond)
+		}
+	}
+
+	h.checkGoroutines()
 }
 
 // Setup creates a new TestHarness
-func Setup(t *testing.T, configOverrides func(*config.Config)) *TestHarness {
+// The servers listen on free ports and the certificates are generated in a
+// temporary directory, so tests using different harnesses can run in parallel.
+// Benchmarks discard the logs of the application.
+func Setup(t testing.TB, configOverrides func(*config.Config), opts ...Option) *TestHarness {
 	assert := require.New(t)
 
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	var err error
-	h := &TestHarness{t: t, LogDebugger: testutil.NewLogDebugger(t, "go-sample-project")}
+	h := &TestHarness{t: t, id: nextHarnessID()}
 
-	h.GoSampleProject, h.cleanup, err = app.BuildTestGoSampleProject(
-		h.LogDebugger, h.LogDebugger, AssetDefaultConfig(), configOverrides)
-	assert.NoError(err)
+	var logWriter io.Writer = io.Discard
+	if tt, ok := t.(*testing.T); ok {
+		h.LogDebugger = testutil.NewLogDebugger(tt, "go-sample-project")
+		logWriter = h.LogDebugger
+	}
+	h.logCapture = newLogCapture(t, logWriter)
+
+	certsDir := t.TempDir()
+	assert.NoError(restoreCerts(certsDir))
+
+	var ports *tcpListeners
+	var listeners server.Listeners
+	if o.inMemory {
+		h.memory = newMemoryListeners()
+		listeners = h.memory.listeners()
+	} else {
+		ports, err = newTCPListeners()
+		assert.NoError(err)
+		listeners = ports.listeners()
+	}
+
+	prodDisabled := false
+	overrides := func(cfg *config.Config) {
+		cfg.API.GRPC.Certs = certs.TLSCredsConfig{
+			TLSKeyPath:    filepath.Join(certsDir, "grpc.key"),
+			TLSCertPath:   filepath.Join(certsDir, "grpc.crt"),
+			TLSCACertPath: filepath.Join(certsDir, "grpc-ca.crt"),
+		}
+		cfg.API.Gateway.Certs = certs.TLSCredsConfig{
+			TLSKeyPath:    filepath.Join(certsDir, "gateway.key"),
+			TLSCertPath:   filepath.Join(certsDir, "gateway.crt"),
+			TLSCACertPath: filepath.Join(certsDir, "gateway-ca.crt"),
+		}
 
-	err = h.GoSampleProject.Server.Start()
+		if ports != nil {
+			cfg.API.Health.ListenAddress = ports.address(server.ListenerHealth)
+			cfg.API.GRPC.ListenAddress = ports.address(server.ListenerGRPC)
+			cfg.API.Gateway.ListenAddress = ports.address(server.ListenerGateway)
+		}
+
+		// logs are captured as JSON, see Logs
+		cfg.Logging.Prod = true
+
+		configOverrides(cfg)
+		if !cfg.Logging.Prod {
+			prodDisabled = true
+		}
+
+		if ports != nil && cfg.API.GRPCWeb.ListenAddress != "" {
+			cfg.API.GRPCWeb.ListenAddress = ports.address(server.ListenerGRPCWeb)
+		}
+
+		if h.memory != nil {
+			cfg.API.Gateway.Upstream.Mode = config.UpstreamInProcess
+		}
+	}
+
+	h.labeled(func() {
+		h.GoSampleProject, h.cleanup, err = app.BuildTestGoSampleProject(
+			h.logCapture, h.logCapture, AssetDefaultConfig(), overrides, listeners)
+	})
+	if err != nil && ports != nil {
+		ports.closeUnused()
+	}
 	assert.NoError(err)
+	assert.False(prodDisabled, "logging.prod can't be disabled, the harness captures the logs as JSON")
+	assert.NoError(saveCerts(certsDir))
+
+	api := h.GoSampleProject.Configuration.API
+	h.HealthAddress = loopbackAddress(api.Health.ListenAddress)
+	h.GatewayAddress = loopbackAddress(api.Gateway.ListenAddress)
+	h.GRPCAddress = loopbackAddress(api.GRPC.ListenAddress)
+	h.GRPCWebAddress = loopbackAddress(api.GRPCWeb.ListenAddress)
 
-	assert.Eventually(func() bool {
-		return testutil.PortOpen("127.0.0.1:8383")
-	}, 10*time.Second, 10*time.Millisecond)
+	h.labeled(func() {
+		err = h.GoSampleProject.Server.Start()
+	})
+	if ports != nil {
+		// the listeners are bound, so they accept connections before the servers are serving
+		ports.closeUnused()
+	}
+	assert.NoError(err)
 
 	return h
 }
+
+// loopbackAddress returns the address a listen address can be dialed at.
+func loopbackAddress(listenAddress string) string {
+	if listenAddress == "" {
+		return ""
+	}
+
+	_, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return listenAddress
+	}
+
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// DialContext connects to one of the servers of the harness. In memory, the
+// connection is made to the listener with the same port as address.
+func (h *TestHarness) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if h.memory != nil {
+		return h.memory.dial(ctx, address)
+	}
+
+	dialer := net.Dialer{}
+	return dialer.DialContext(ctx, network, address)
+}
@@ -0,0 +1,116 @@
+package testharness
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// goroutineLabel is the pprof label of the goroutines started by a harness.
+// Goroutines inherit the labels of the goroutine that starts them, so the
+// goroutines of the application can be told apart from the goroutines of
+// other harnesses running in parallel.
+//
+// Leaks are found with this label rather than by comparing all goroutines
+// with a snapshot taken at Setup: with parallel tests, a snapshot reports the
+// goroutines of the other tests as leaks. The flip side is that goroutines
+// without the label aren't checked. They are the goroutines started by the
+// test itself, like the connections of its HTTP and gRPC clients, and the
+// goroutines that packages start from their init functions.
+const goroutineLabel = "testharness"
+
+const leakTimeout = 10 * time.Second
+
+var harnessSeq int64
+
+// knownGoroutines are functions of goroutines that are expected to outlive
+// the application, e.g. workers that packages start once per process.
+var knownGoroutines = []string{
+	// started by the first call to signal.Notify in the process
+	"os/signal.loop",
+}
+
+func nextHarnessID() string {
+	return fmt.Sprint(atomic.AddInt64(&harnessSeq, 1))
+}
+
+// labeled runs f with the goroutine label of the harness.
+func (h *TestHarness) labeled(f func()) {
+	pprof.Do(context.Background(), pprof.Labels(goroutineLabel, h.id), func(context.Context) {
+		f()
+	})
+}
+
+// leakedGoroutines returns the stacks of the goroutines that were started by
+// the harness and are still running, except for knownGoroutines.
+// Goroutines with the same stack are reported once, with their count.
+func (h *TestHarness) leakedGoroutines() []string {
+	label := fmt.Sprintf("%q:%q", goroutineLabel, h.id)
+
+	buf := bytes.Buffer{}
+	_ = pprof.Lookup("goroutine").WriteTo(&buf, 1)
+
+	leaked := []string{}
+	for _, record := range strings.Split(buf.String(), "\n\n") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+
+		labeled := false
+		stack := []string{}
+		for _, line := range lines[1:] {
+			switch {
+			case strings.HasPrefix(line, "# labels:"):
+				labeled = strings.Contains(line, label)
+			case strings.HasPrefix(line, "#\t"):
+				// "#\t<pc>\t<function>+<offset>\t<file>:<line>"
+				fields := strings.Fields(line)
+				if len(fields) >= 4 {
+					function := strings.SplitN(fields[2], "+", 2)[0]
+					stack = append(stack, fmt.Sprintf("    %s\n        %s", function, fields[3]))
+				}
+			}
+		}
+
+		if !labeled || isKnownGoroutine(stack) {
+			continue
+		}
+
+		// "<count> @ <pc>..."
+		count := strings.SplitN(lines[0], " ", 2)[0]
+		leaked = append(leaked, fmt.Sprintf("%s goroutine(s):\n%s", count, strings.Join(stack, "\n")))
+	}
+
+	return leaked
+}
+
+func isKnownGoroutine(stack []string) bool {
+	for _, frame := range stack {
+		for _, known := range knownGoroutines {
+			if strings.Contains(frame, known) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkGoroutines fails the test with the stacks of the goroutines of the
+// application that are still running after the leak timeout.
+func (h *TestHarness) checkGoroutines() {
+	deadline := time.Now().Add(leakTimeout)
+
+	leaked := h.leakedGoroutines()
+	for len(leaked) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		leaked = h.leakedGoroutines()
+	}
+
+	if len(leaked) > 0 {
+		h.t.Errorf("goroutines started by the harness are still running after Cleanup:\n\n%s",
+			strings.Join(leaked, "\n\n"))
+	}
+}
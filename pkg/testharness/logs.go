@@ -0,0 +1,167 @@
+package testharness
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// LogEntry is a structured log event of the application, as written by zerolog.
+type LogEntry map[string]interface{}
+
+// Level returns the level of the entry, e.g. "info".
+func (e LogEntry) Level() string {
+	return e.str(zerolog.LevelFieldName)
+}
+
+// Message returns the message of the entry.
+func (e LogEntry) Message() string {
+	return e.str(zerolog.MessageFieldName)
+}
+
+// Component returns the component that logged the entry.
+func (e LogEntry) Component() string {
+	return e.str("component")
+}
+
+func (e LogEntry) str(field string) string {
+	if v, ok := e[field]; ok {
+		return fmt.Sprint(v)
+	}
+
+	return ""
+}
+
+// LogQuery selects log entries. Empty fields of the query match all entries.
+type LogQuery struct {
+	Level     string
+	Component string
+	// Message matches entries whose message contains it
+	Message string
+	// Fields match entries that have the same values, compared by their string representation
+	Fields map[string]interface{}
+}
+
+// Matches returns true if the entry is selected by the query.
+func (q *LogQuery) Matches(e LogEntry) bool {
+	if q.Level != "" && q.Level != e.Level() {
+		return false
+	}
+
+	if q.Component != "" && q.Component != e.Component() {
+		return false
+	}
+
+	if q.Message != "" && !strings.Contains(e.Message(), q.Message) {
+		return false
+	}
+
+	for field, expected := range q.Fields {
+		actual, ok := e[field]
+		if !ok || fmt.Sprint(actual) != fmt.Sprint(expected) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// logCapture records the structured logs of the application, before passing
+// them on to the next writer. Its assertions fail the test t.
+type logCapture struct {
+	t    testing.TB
+	next io.Writer
+
+	mu      sync.Mutex
+	entries []LogEntry
+	// written is closed and replaced whenever an entry is added
+	written chan struct{}
+}
+
+func newLogCapture(t testing.TB, next io.Writer) *logCapture {
+	return &logCapture{t: t, next: next, written: make(chan struct{})}
+}
+
+// Write is called by zerolog with one event at a time. Writes are serialized,
+// as the next writer isn't necessarily safe for concurrent use.
+func (c *logCapture) Write(p []byte) (int, error) {
+	entry := LogEntry{}
+	if err := json.Unmarshal(p, &entry); err != nil {
+		entry = LogEntry{zerolog.MessageFieldName: strings.TrimSpace(string(p))}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = append(c.entries, entry)
+	close(c.written)
+	c.written = make(chan struct{})
+
+	return c.next.Write(p)
+}
+
+func (c *logCapture) find(q *LogQuery) (found []LogEntry, written <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range c.entries {
+		if q.Matches(e) {
+			found = append(found, e)
+		}
+	}
+
+	return found, c.written
+}
+
+// Logs returns the log entries matching the query, in the order they were written.
+func (c *logCapture) Logs(q LogQuery) []LogEntry {
+	found, _ := c.find(&q)
+	return found
+}
+
+// AssertLogged fails the test unless an entry matching the query was logged.
+// It returns the first matching entry.
+func (c *logCapture) AssertLogged(q LogQuery) LogEntry {
+	found := c.Logs(q)
+	require.NotEmpty(c.t, found, "no log entry matches %+v", q)
+
+	return found[0]
+}
+
+// AssertNotLogged fails the test if an entry matching the query was logged.
+func (c *logCapture) AssertNotLogged(q LogQuery) {
+	found := c.Logs(q)
+	require.Empty(c.t, found, "log entries match %+v", q)
+}
+
+// AssertNoErrorLogs fails the test if entries were logged at the error level or above.
+func (c *logCapture) AssertNoErrorLogs() {
+	for _, level := range []zerolog.Level{zerolog.ErrorLevel, zerolog.FatalLevel, zerolog.PanicLevel} {
+		c.AssertNotLogged(LogQuery{Level: level.String()})
+	}
+}
+
+// WaitForLog waits until an entry matching the query is logged and returns it.
+// It fails the test if no entry matches before the timeout.
+func (c *logCapture) WaitForLog(q LogQuery, timeout time.Duration) LogEntry {
+	deadline := time.After(timeout)
+	for {
+		found, written := c.find(&q)
+		if len(found) > 0 {
+			return found[0]
+		}
+
+		select {
+		case <-written:
+		case <-deadline:
+			require.FailNow(c.t, "timed out waiting for log entry", "no log entry matches %+v after %s", q, timeout)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package testharness
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BodyMatcher describes the expected JSON body of a response.
+// All matchers that are set must match.
+type BodyMatcher struct {
+	// Exact is compared with the whole body, except for the Ignore paths
+	Exact interface{} `yaml:"exact"`
+	// Subset matches bodies that contain all of its fields, with the same values
+	Subset interface{} `yaml:"subset"`
+	// Regex maps paths to regular expressions their values must match
+	Regex map[string]string `yaml:"regex"`
+	// Ignore lists paths that are removed from the body before comparing it with Exact
+	Ignore []string `yaml:"ignore"`
+	// Golden is the name of a golden file the body is compared with, see AssertGolden.
+	// The Ignore paths are normalized like volatile fields
+	Golden string `yaml:"golden"`
+}
+
+// Match returns an error that describes the first difference between the
+// matcher and body. Paths are dot separated field names and array indexes,
+// e.g. "details.0.reason".
+func (m *BodyMatcher) Match(body []byte) error {
+	var actual interface{}
+	if err := json.Unmarshal(body, &actual); err != nil {
+		return errors.Wrapf(err, "body is not JSON: %s", body)
+	}
+
+	for path, expr := range m.Regex {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return errors.Wrapf(err, "invalid regex for '%s'", path)
+		}
+
+		value, ok := jsonPath(actual, path)
+		if !ok {
+			return errors.Errorf("'%s' is missing", path)
+		}
+
+		if s := jsonString(value); !re.MatchString(s) {
+			return errors.Errorf("'%s' is %s, which doesn't match '%s'", path, s, expr)
+		}
+	}
+
+	if m.Subset != nil {
+		expected, err := normalizeJSON(m.Subset)
+		if err != nil {
+			return err
+		}
+
+		if err := matchSubset("", expected, actual); err != nil {
+			return err
+		}
+	}
+
+	if m.Golden != "" {
+		if err := compareGolden(m.Golden, body, m.Ignore...); err != nil {
+			return err
+		}
+	}
+
+	if m.Exact != nil {
+		expected, err := normalizeJSON(m.Exact)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range m.Ignore {
+			expected = deleteJSONPath(expected, path)
+			actual = deleteJSONPath(actual, path)
+		}
+
+		if !reflect.DeepEqual(expected, actual) {
+			return errors.Errorf("body is %s, expected %s", jsonString(actual), jsonString(expected))
+		}
+	}
+
+	return nil
+}
+
+// normalizeJSON converts values decoded from YAML to the types used by encoding/json.
+func normalizeJSON(value interface{}) (interface{}, error) {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert expected body to JSON")
+	}
+
+	var normalized interface{}
+	if err := json.Unmarshal(buf, &normalized); err != nil {
+		return nil, errors.Wrap(err, "failed to convert expected body to JSON")
+	}
+
+	return normalized, nil
+}
+
+func matchSubset(path string, expected, actual interface{}) error {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("'%s' is %s, expected an object", path, jsonString(actual))
+		}
+
+		for key, value := range e {
+			field := joinPath(path, key)
+			if _, ok := a[key]; !ok {
+				return errors.Errorf("'%s' is missing", field)
+			}
+
+			if err := matchSubset(field, value, a[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(e) {
+			return errors.Errorf("'%s' is %s, expected %d elements", path, jsonString(actual), len(e))
+		}
+
+		for i := range e {
+			if err := matchSubset(joinPath(path, strconv.Itoa(i)), e[i], a[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		if !reflect.DeepEqual(expected, actual) {
+			return errors.Errorf("'%s' is %s, expected %s", path, jsonString(actual), jsonString(expected))
+		}
+	}
+
+	return nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// jsonPath returns the value at path.
+func jsonPath(value interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// deleteJSONPath removes the field at path from objects, array elements are
+// left in place.
+func deleteJSONPath(value interface{}, path string) interface{} {
+	if m, key, ok := parentJSONObject(value, path); ok {
+		delete(m, key)
+	}
+
+	return value
+}
+
+// replaceJSONPath replaces the value of the field at path, if it exists.
+func replaceJSONPath(value interface{}, path string, replacement interface{}) {
+	if m, key, ok := parentJSONObject(value, path); ok {
+		if _, exists := m[key]; exists {
+			m[key] = replacement
+		}
+	}
+}
+
+// parentJSONObject returns the object containing the field at path, and the
+// name of the field.
+func parentJSONObject(value interface{}, path string) (map[string]interface{}, string, bool) {
+	parent, key := "", path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		parent, key = path[:i], path[i+1:]
+	}
+
+	container := value
+	if parent != "" {
+		var ok bool
+		if container, ok = jsonPath(value, parent); !ok {
+			return nil, "", false
+		}
+	}
+
+	m, ok := container.(map[string]interface{})
+
+	return m, key, ok
+}
+
+// jsonString formats strings as they are and other values as JSON.
+func jsonString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(buf)
+}
@@ -0,0 +1,127 @@
+package testharness
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/aserto-dev/go-sample-project/pkg/app/server"
+)
+
+// memoryListeners replaces the TCP listeners of the servers with in-memory
+// listeners, which are dialed by the port of their listen address.
+type memoryListeners struct {
+	mu     sync.Mutex
+	byPort map[string]*pipeListener
+}
+
+func newMemoryListeners() *memoryListeners {
+	return &memoryListeners{byPort: map[string]*pipeListener{}}
+}
+
+func (m *memoryListeners) listeners() server.Listeners {
+	return func(_, address string) (net.Listener, error) {
+		_, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid listen address '%s'", address)
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		lis := newPipeListener(address)
+		m.byPort[port] = lis
+
+		return lis, nil
+	}
+}
+
+func (m *memoryListeners) dial(ctx context.Context, address string) (net.Conn, error) {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid address '%s'", address)
+	}
+
+	m.mu.Lock()
+	lis, ok := m.byPort[port]
+	m.mu.Unlock()
+
+	if !ok {
+		return nil, errors.Errorf("no in-memory listener for '%s'", address)
+	}
+
+	return lis.dial(ctx)
+}
+
+// open returns the addresses of the listeners that haven't been closed.
+func (m *memoryListeners) open() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	addresses := []string{}
+	for _, lis := range m.byPort {
+		select {
+		case <-lis.closed:
+		default:
+			addresses = append(addresses, lis.addr.String())
+		}
+	}
+
+	return addresses
+}
+
+// pipeListener accepts connections created with net.Pipe.
+// Unlike bufconn, net.Pipe supports deadlines being reset, which
+// net/http relies on when hijacking connections for WebSockets.
+type pipeListener struct {
+	addr   pipeAddr
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newPipeListener(address string) *pipeListener {
+	return &pipeListener{
+		addr:   pipeAddr(address),
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return l.addr
+}
+
+func (l *pipeListener) dial(ctx context.Context) (net.Conn, error) {
+	server, client := net.Pipe()
+
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, errors.Errorf("listener %s is closed", l.addr)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type pipeAddr string
+
+func (pipeAddr) Network() string  { return "pipe" }
+func (a pipeAddr) String() string { return string(a) }
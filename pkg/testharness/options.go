@@ -0,0 +1,17 @@
+package testharness
+
+// Option configures a TestHarness.
+type Option func(*options)
+
+type options struct {
+	inMemory bool
+}
+
+// WithInMemory serves the API over in-memory listeners instead of TCP ports.
+// The servers can only be reached through the clients created by the harness,
+// and the gateway always uses the in-process gRPC upstream.
+func WithInMemory() Option {
+	return func(o *options) {
+		o.inMemory = true
+	}
+}
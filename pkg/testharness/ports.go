@@ -0,0 +1,60 @@
+package testharness
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+
+	"github.com/aserto-dev/go-sample-project/pkg/app/server"
+)
+
+// tcpListeners listens on free ports of the loopback interface, so several
+// harnesses can run at the same time. The listeners are created up front and
+// handed over to the servers, so no other process can take their ports.
+type tcpListeners struct {
+	byName map[string]net.Listener
+	used   map[string]bool
+}
+
+func newTCPListeners() (*tcpListeners, error) {
+	l := &tcpListeners{byName: map[string]net.Listener{}, used: map[string]bool{}}
+
+	for _, name := range []string{server.ListenerHealth, server.ListenerGRPC, server.ListenerGateway, server.ListenerGRPCWeb} {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			l.closeUnused()
+			return nil, errors.Wrapf(err, "failed to listen for the %s server", name)
+		}
+
+		l.byName[name] = lis
+	}
+
+	return l, nil
+}
+
+func (l *tcpListeners) address(name string) string {
+	return l.byName[name].Addr().String()
+}
+
+func (l *tcpListeners) listeners() server.Listeners {
+	return func(name, address string) (net.Listener, error) {
+		lis, ok := l.byName[name]
+		if !ok || l.used[name] {
+			return nil, errors.Errorf("no listener available for the %s server", name)
+		}
+
+		l.used[name] = true
+
+		return lis, nil
+	}
+}
+
+// closeUnused closes the listeners of servers that weren't started, so
+// their ports are closed like they would be for the application.
+func (l *tcpListeners) closeUnused() {
+	for name, lis := range l.byName {
+		if !l.used[name] {
+			_ = lis.Close()
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package testharness
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aserto-dev/go-utils/certs"
+	"github.com/aserto-dev/go-utils/testutil"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+)
+
+const (
+	// readinessService is the health service that reports if the application is ready
+	readinessService = "grpc.health.v1.go-sample-project"
+
+	processReadyTimeout = 30 * time.Second
+	processKillTimeout  = 10 * time.Second
+	// processOutputTimeout is how long Wait waits for the output after the process exited
+	processOutputTimeout = time.Second
+)
+
+var binary struct {
+	once sync.Once
+	dir  string
+	path string
+	err  error
+}
+
+// BuildBinary compiles the go-sample-project command once per test process
+// and returns its path. Call RemoveBinary from TestMain to delete it.
+func BuildBinary(t testing.TB) string {
+	binary.once.Do(func() {
+		binary.dir, binary.err = os.MkdirTemp("", "go-sample-project-e2e-*")
+		if binary.err != nil {
+			return
+		}
+
+		binary.path = filepath.Join(binary.dir, "go-sample-project")
+
+		cmd := exec.Command("go", "build", "-o", binary.path, "./cmd/go-sample-project")
+		cmd.Dir = moduleDir()
+		if out, err := cmd.CombinedOutput(); err != nil {
+			binary.err = errors.Wrapf(err, "failed to build go-sample-project: %s", out)
+		}
+	})
+
+	require.NoError(t, binary.err)
+
+	return binary.path
+}
+
+// RemoveBinary deletes the binary compiled by BuildBinary.
+func RemoveBinary() {
+	if binary.dir != "" {
+		_ = os.RemoveAll(binary.dir)
+	}
+}
+
+// Process runs the compiled go-sample-project command with a generated
+// config file, for black-box tests of the command line, signal handling and
+// exit codes.
+type Process struct {
+	Cmd *exec.Cmd
+	// ConfigPath is the path of the generated config file
+	ConfigPath string
+
+	// Addresses the servers listen on
+	GRPCAddress    string
+	GatewayAddress string
+	HealthAddress  string
+
+	t testing.TB
+	// logCapture provides the log assertions of the process, for its
+	// stdout and stderr
+	*logCapture
+	stdout *lineWriter
+	stderr *lineWriter
+
+	done    chan struct{}
+	waitErr error
+}
+
+// StartProcess runs the binary, see RunProcess, and waits until it reports
+// that it is ready on its health server.
+func StartProcess(t testing.TB, configOverrides func(*config.Config), args ...string) *Process {
+	p := RunProcess(t, configOverrides, args...)
+	p.WaitReady(processReadyTimeout)
+
+	return p
+}
+
+// RunProcess runs the binary with the run command and args, see NewProcess.
+func RunProcess(t testing.TB, configOverrides func(*config.Config), args ...string) *Process {
+	p := NewProcess(t, configOverrides, args...)
+	p.Start()
+
+	return p
+}
+
+// NewProcess prepares the binary to run with the run command and args. The config
+// file is generated from the default test config and configOverrides, with free
+// ports, JSON logs and certificates in a temporary directory. Cmd can be changed,
+// e.g. to set environment variables, before Start is called.
+func NewProcess(t testing.TB, configOverrides func(*config.Config), args ...string) *Process {
+	assert := require.New(t)
+
+	bin := BuildBinary(t)
+	dir := t.TempDir()
+	assert.NoError(restoreCerts(dir))
+
+	p := &Process{
+		ConfigPath: filepath.Join(dir, "config.yaml"),
+		t:          t,
+		done:       make(chan struct{}),
+	}
+
+	var logWriter io.Writer = io.Discard
+	if tt, ok := t.(*testing.T); ok {
+		logWriter = testutil.NewLogDebugger(tt, "go-sample-project")
+	}
+	p.logCapture = newLogCapture(t, logWriter)
+	p.stdout = &lineWriter{next: p.logCapture}
+	p.stderr = &lineWriter{next: p.logCapture}
+
+	var err error
+	for _, address := range []*string{&p.GRPCAddress, &p.GatewayAddress, &p.HealthAddress} {
+		*address, err = freeAddress()
+		assert.NoError(err)
+	}
+
+	discard := zerolog.New(io.Discard)
+	cfg, err := config.NewConfig(AssetDefaultConfig(), &discard, func(cfg *config.Config) {
+		cfg.Logging.Prod = true
+		cfg.API.GRPC.ListenAddress = p.GRPCAddress
+		cfg.API.Gateway.ListenAddress = p.GatewayAddress
+		cfg.API.Health.ListenAddress = p.HealthAddress
+		cfg.API.GRPC.Certs = certs.TLSCredsConfig{
+			TLSKeyPath:    filepath.Join(dir, "grpc.key"),
+			TLSCertPath:   filepath.Join(dir, "grpc.crt"),
+			TLSCACertPath: filepath.Join(dir, "grpc-ca.crt"),
+		}
+		cfg.API.Gateway.Certs = certs.TLSCredsConfig{
+			TLSKeyPath:    filepath.Join(dir, "gateway.key"),
+			TLSCertPath:   filepath.Join(dir, "gateway.crt"),
+			TLSCACertPath: filepath.Join(dir, "gateway-ca.crt"),
+		}
+
+		configOverrides(cfg)
+	}, certs.NewGenerator(&discard))
+	assert.NoError(err)
+	assert.True(cfg.Logging.Prod, "logging.prod can't be disabled, the harness captures the logs as JSON")
+	assert.NoError(saveCerts(dir))
+
+	// JSON is valid YAML, and has the same keys as the config struct
+	buf, err := json.Marshal(cfg)
+	assert.NoError(err)
+	assert.NoError(os.WriteFile(p.ConfigPath, buf, 0o600))
+
+	p.Cmd = exec.Command(bin, append([]string{"--config", p.ConfigPath, "run"}, args...)...) // nolint:gosec // test binary
+
+	return p
+}
+
+// Start starts the process. Its output is read from pipes, rather than by exec.Cmd,
+// so Wait returns when it exits even if processes it started, which inherited the
+// pipes, are still running.
+func (p *Process) Start() {
+	assert := require.New(p.t)
+
+	var output sync.WaitGroup
+	stdout, err := p.pipe(&output, p.stdout)
+	assert.NoError(err)
+	stderr, err := p.pipe(&output, p.stderr)
+	assert.NoError(err)
+
+	p.Cmd.Stdout = stdout
+	p.Cmd.Stderr = stderr
+	err = p.Cmd.Start()
+	_ = stdout.Close()
+	_ = stderr.Close()
+	assert.NoError(err)
+
+	go func() {
+		p.waitErr = p.Cmd.Wait()
+
+		// wait for the rest of the output
+		written := make(chan struct{})
+		go func() {
+			output.Wait()
+			close(written)
+		}()
+		select {
+		case <-written:
+		case <-time.After(processOutputTimeout):
+		}
+
+		close(p.done)
+	}()
+}
+
+// pipe returns the write end of a pipe whose output is copied to w.
+func (p *Process) pipe(output *sync.WaitGroup, w *lineWriter) (*os.File, error) {
+	r, pw, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create output pipe")
+	}
+
+	output.Add(1)
+	go func() {
+		defer output.Done()
+		defer r.Close()
+
+		_, _ = io.Copy(w, r)
+		w.flush()
+	}()
+
+	return pw, nil
+}
+
+// WaitReady waits until the readiness service of the process reports
+// SERVING. It fails the test if the process exits or the timeout expires.
+func (p *Process) WaitReady(timeout time.Duration) {
+	assert := require.New(p.t)
+
+	conn, err := grpc.Dial(p.HealthAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(err)
+	defer conn.Close()
+
+	client := healthpb.NewHealthClient(conn)
+	deadline := time.After(timeout)
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: readinessService})
+		cancel()
+
+		if err == nil && resp.GetStatus() == healthpb.HealthCheckResponse_SERVING {
+			return
+		}
+
+		select {
+		case <-p.done:
+			assert.FailNow("process exited before it was ready", "%v", p.waitErr)
+		case <-deadline:
+			assert.FailNow("process isn't ready", "after %s", timeout)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// Signal sends a signal to the process.
+func (p *Process) Signal(sig os.Signal) {
+	require.NoError(p.t, p.Cmd.Process.Signal(sig))
+}
+
+// Wait waits for the process to exit and returns its exit code, which is -1
+// if it was terminated by a signal. It fails the test if the timeout expires.
+func (p *Process) Wait(timeout time.Duration) int {
+	select {
+	case <-p.done:
+	case <-time.After(timeout):
+		require.FailNow(p.t, "process didn't exit", "after %s", timeout)
+	}
+
+	return p.Cmd.ProcessState.ExitCode()
+}
+
+// Cleanup kills the process if it's still running.
+func (p *Process) Cleanup() {
+	if p.Cmd.Process == nil {
+		return
+	}
+
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+
+	_ = p.Cmd.Process.Kill()
+	p.Wait(processKillTimeout)
+}
+
+// freeAddress returns a loopback address with a port that was free when it was called.
+func freeAddress() (string, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to find a free port")
+	}
+	defer lis.Close()
+
+	return lis.Addr().String(), nil
+}
+
+// lineWriter writes the output of the process to the next writer one line at a time,
+// as zerolog would.
+type lineWriter struct {
+	next io.Writer
+	buf  []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		if _, err := w.next.Write(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		_, _ = w.next.Write(w.buf)
+		w.buf = nil
+	}
+}
@@ -0,0 +1,78 @@
+package testharness
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// resolveMethod looks up a method, e.g. "aserto.common.info.v1.Info/Info",
+// with the reflection service of the gRPC server.
+func resolveMethod(ctx context.Context, conn *grpc.ClientConn, method string) (protoreflect.MethodDescriptor, error) {
+	parts := strings.Split(strings.TrimPrefix(method, "/"), "/")
+	if len(parts) != 2 {
+		return nil, errors.Errorf("invalid method '%s', expected <service>/<method>", method)
+	}
+	service, name := parts[0], parts[1]
+
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to call the reflection service")
+	}
+	defer func() { _ = stream.CloseSend() }()
+
+	err = stream.Send(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send reflection request")
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to receive reflection response")
+	}
+
+	if errResp := resp.GetErrorResponse(); errResp != nil {
+		return nil, errors.Errorf("failed to resolve service '%s': %s", service, errResp.GetErrorMessage())
+	}
+
+	// the response contains the file of the service and all of its dependencies
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, buf := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		file := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(buf, file); err != nil {
+			return nil, errors.Wrap(err, "failed to decode file descriptor")
+		}
+		set.File = append(set.File, file)
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load the descriptors of service '%s'", service)
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, errors.Wrapf(err, "service '%s' not found", service)
+	}
+
+	svc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, errors.Errorf("'%s' is not a service", service)
+	}
+
+	md := svc.Methods().ByName(protoreflect.Name(name))
+	if md == nil {
+		return nil, errors.Errorf("method '%s' not found in service '%s'", name, service)
+	}
+
+	return md, nil
+}
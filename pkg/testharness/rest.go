@@ -0,0 +1,77 @@
+package testharness
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// GatewayURL returns the URL of path on the gateway.
+func (h *TestHarness) GatewayURL(path string) string {
+	return "https://" + h.GatewayAddress + path
+}
+
+// Get calls a REST endpoint of the gateway, see Do.
+func (h *TestHarness) Get(t testing.TB, path string, out proto.Message) *http.Response {
+	return h.Do(t, http.MethodGet, path, nil, out)
+}
+
+// Post calls a REST endpoint of the gateway with in as the body, see Do.
+func (h *TestHarness) Post(t testing.TB, path string, in, out proto.Message) *http.Response {
+	return h.Do(t, http.MethodPost, path, in, out)
+}
+
+// Do calls a REST endpoint of the gateway, sending in as JSON unless it's nil.
+// The body of a successful response is decoded into out, unless it's nil.
+// The body of the returned response can be read again, e.g. with AssertErrorEnvelope.
+// Errors fail t, which is the test or subtest that calls it.
+func (h *TestHarness) Do(t testing.TB, method, path string, in, out proto.Message) *http.Response {
+	assert := require.New(t)
+
+	body := []byte{}
+	if in != nil {
+		var err error
+		body, err = protojson.Marshal(in)
+		assert.NoError(err)
+	}
+
+	req, err := http.NewRequest(method, h.GatewayURL(path), bytes.NewReader(body))
+	assert.NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, respBody := h.RoundTrip(t, req)
+
+	if out != nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		assert.NoError(protojson.Unmarshal(respBody, out), "failed to decode %s", respBody)
+	}
+
+	return resp
+}
+
+// RoundTrip sends req with a client shared by the helpers and returns the
+// response along with its body, which can also be read again from the response.
+// It's for requests that Do can't make, e.g. with other content types.
+// Errors fail t, which is the test or subtest that calls it.
+func (h *TestHarness) RoundTrip(t testing.TB, req *http.Request) (*http.Response, []byte) {
+	assert := require.New(t)
+
+	h.restClientOnce.Do(func() {
+		h.restClient = h.CreateClient(t)
+	})
+	assert.NotNil(h.restClient, "the shared REST client couldn't be created")
+
+	resp, err := h.restClient.Do(req)
+	assert.NoError(err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(err)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	return resp, body
+}
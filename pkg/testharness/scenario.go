@@ -0,0 +1,280 @@
+package testharness
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"gopkg.in/yaml.v3"
+
+	"github.com/aserto-dev/go-sample-project/pkg/cc/config"
+)
+
+const scenarioCallTimeout = 10 * time.Second
+
+// Scenario is a sequence of API calls made against a single harness.
+// Scenarios are loaded from YAML files, see RunScenarios.
+type Scenario struct {
+	// InMemory sets up the harness WithInMemory
+	InMemory bool `yaml:"in_memory"`
+	// Config is merged into the configuration, it has the same keys as the config file
+	Config map[string]interface{} `yaml:"config"`
+	Steps  []ScenarioStep         `yaml:"steps"`
+}
+
+// ScenarioStep is a single API call, either REST or gRPC, and its expected result.
+type ScenarioStep struct {
+	Name   string      `yaml:"name"`
+	REST   *RESTCall   `yaml:"rest"`
+	GRPC   *GRPCCall   `yaml:"grpc"`
+	Expect Expectation `yaml:"expect"`
+}
+
+// RESTCall is a call to the gateway.
+type RESTCall struct {
+	// Defaults to GET
+	Method  string            `yaml:"method"`
+	Path    string            `yaml:"path"`
+	Headers map[string]string `yaml:"headers"`
+	// Sent as JSON, unless it's empty
+	Body interface{} `yaml:"body"`
+}
+
+// GRPCCall is a unary call to the gRPC server. The messages are described by
+// the reflection service of the server.
+type GRPCCall struct {
+	// Full name of the method, e.g. aserto.common.info.v1.Info/Info
+	Method   string            `yaml:"method"`
+	Metadata map[string]string `yaml:"metadata"`
+	// The request in the JSON representation of the request message
+	Body interface{} `yaml:"body"`
+}
+
+// Expectation is the expected result of a ScenarioStep.
+type Expectation struct {
+	// HTTP status of REST calls, defaults to 200
+	Status int `yaml:"status"`
+	// gRPC status code of gRPC calls, e.g. NOT_FOUND, defaults to OK
+	Code string `yaml:"code"`
+	// Response headers of REST calls or header metadata of gRPC calls
+	Headers map[string]string `yaml:"headers"`
+	// The body of gRPC calls is the JSON representation of the response message,
+	// or {"code": ..., "message": ...} for errors
+	Body *BodyMatcher `yaml:"body"`
+}
+
+// LoadScenario reads a scenario from a YAML file. Unknown keys are errors.
+func LoadScenario(path string) (*Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open scenario '%s'", path)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+
+	scenario := &Scenario{}
+	if err := decoder.Decode(scenario); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode scenario '%s'", path)
+	}
+
+	return scenario, nil
+}
+
+// RunScenarios runs the scenario files matching pattern, relative to the
+// testdata directory, e.g. "scenarios/*.yaml". Each file runs in parallel as
+// a subtest named after the file, against its own harness.
+func RunScenarios(t *testing.T, pattern string) {
+	files, err := filepath.Glob(filepath.Join(AssetsDir(), pattern))
+	require.NoError(t, err)
+	require.NotEmpty(t, files, "no scenarios match '%s'", pattern)
+
+	for _, file := range files {
+		file := file
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			RunScenario(t, file)
+		})
+	}
+}
+
+// RunScenario runs the steps of a scenario file in order.
+func RunScenario(t *testing.T, path string) {
+	assert := require.New(t)
+
+	scenario, err := LoadScenario(path)
+	assert.NoError(err)
+
+	configJSON, err := json.Marshal(scenario.Config)
+	assert.NoError(err)
+
+	opts := []Option{}
+	if scenario.InMemory {
+		opts = append(opts, WithInMemory())
+	}
+
+	h := Setup(t, func(cfg *config.Config) {
+		if scenario.Config == nil {
+			return
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(configJSON))
+		decoder.DisallowUnknownFields()
+		assert.NoError(decoder.Decode(cfg), "invalid scenario config")
+	}, opts...)
+	defer h.Cleanup()
+
+	for i := range scenario.Steps {
+		step := &scenario.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step %d", i+1)
+		}
+
+		assert.NoError(h.runStep(step), "step '%s' of %s", step.Name, filepath.Base(path))
+	}
+}
+
+func (h *TestHarness) runStep(step *ScenarioStep) error {
+	switch {
+	case step.REST != nil && step.GRPC == nil:
+		return h.runRESTCall(step.REST, &step.Expect)
+	case step.GRPC != nil && step.REST == nil:
+		return h.runGRPCCall(step.GRPC, &step.Expect)
+	default:
+		return errors.New("steps need either a rest or a grpc call")
+	}
+}
+
+func (h *TestHarness) runRESTCall(call *RESTCall, expect *Expectation) error {
+	method := call.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	body := []byte{}
+	if call.Body != nil {
+		var err error
+		if body, err = json.Marshal(call.Body); err != nil {
+			return errors.Wrap(err, "failed to encode request body")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), scenarioCallTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, h.GatewayURL(call.Path), bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range call.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, respBody := h.RoundTrip(h.t, req)
+
+	expectedStatus := expect.Status
+	if expectedStatus == 0 {
+		expectedStatus = http.StatusOK
+	}
+	if resp.StatusCode != expectedStatus {
+		return errors.Errorf("status is %d, expected %d: %s", resp.StatusCode, expectedStatus, respBody)
+	}
+
+	for k, v := range expect.Headers {
+		if actual := resp.Header.Get(k); actual != v {
+			return errors.Errorf("header '%s' is '%s', expected '%s'", k, actual, v)
+		}
+	}
+
+	if expect.Body != nil {
+		return expect.Body.Match(respBody)
+	}
+
+	return nil
+}
+
+func (h *TestHarness) runGRPCCall(call *GRPCCall, expect *Expectation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), scenarioCallTimeout)
+	defer cancel()
+
+	conn := h.GRPCConn(h.t)
+
+	md, err := resolveMethod(ctx, conn, call.Method)
+	if err != nil {
+		return err
+	}
+
+	body := []byte("{}")
+	if call.Body != nil {
+		if body, err = json.Marshal(call.Body); err != nil {
+			return errors.Wrap(err, "failed to encode request body")
+		}
+	}
+
+	in := dynamicpb.NewMessage(md.Input())
+	if err := protojson.Unmarshal(body, in); err != nil {
+		return errors.Wrapf(err, "invalid request for %s", md.FullName())
+	}
+	out := dynamicpb.NewMessage(md.Output())
+
+	for k, v := range call.Metadata {
+		ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+	}
+
+	header := metadata.MD{}
+	err = conn.Invoke(ctx, "/"+strings.TrimPrefix(call.Method, "/"), in, out, grpc.Header(&header))
+
+	st := status.Convert(err)
+	expectedCode := expect.Code
+	if expectedCode == "" {
+		expectedCode = code.Code_OK.String()
+	}
+	if actual := code.Code(st.Code()).String(); actual != expectedCode {
+		return errors.Errorf("code is %s, expected %s: %s", actual, expectedCode, st.Message())
+	}
+
+	for k, v := range expect.Headers {
+		if actual := strings.Join(header.Get(k), ","); actual != v {
+			return errors.Errorf("header '%s' is '%s', expected '%s'", k, actual, v)
+		}
+	}
+
+	if expect.Body == nil {
+		return nil
+	}
+
+	var respBody []byte
+	if err != nil {
+		respBody, err = json.Marshal(map[string]string{
+			"code":    code.Code(st.Code()).String(),
+			"message": st.Message(),
+		})
+	} else {
+		respBody, err = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(out)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to encode response body")
+	}
+
+	return expect.Body.Match(respBody)
+}
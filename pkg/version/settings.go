@@ -0,0 +1,19 @@
+//go:build go1.18
+// +build go1.18
+
+package version
+
+import (
+	"runtime/debug"
+)
+
+// buildSettings returns the build settings embedded by the go command, like
+// vcs.revision, by key.
+func buildSettings(buildInfo *debug.BuildInfo) map[string]string {
+	settings := map[string]string{}
+	for _, setting := range buildInfo.Settings {
+		settings[setting.Key] = setting.Value
+	}
+
+	return settings
+}
@@ -0,0 +1,13 @@
+//go:build !go1.18
+// +build !go1.18
+
+package version
+
+import (
+	"runtime/debug"
+)
+
+// build settings are embedded since Go 1.18
+func buildSettings(*debug.BuildInfo) map[string]string {
+	return map[string]string{}
+}
@@ -3,7 +3,9 @@ package version
 import (
 	"fmt"
 	"runtime"
-	"time"
+	"runtime/debug"
+	"strings"
+	"sync"
 )
 
 // values set by linker using ldflag -X
@@ -13,31 +15,98 @@ var (
 	commit string // nolint:gochecknoglobals // set by linker
 )
 
+// shortCommitLength is the length of the commits set by the release builds
+const shortCommitLength = 7
+
 // Info - version info.
 type Info struct {
-	Version string
-	Date    string
-	Commit  string
+	Version string `json:"version" yaml:"version"`
+	Date    string `json:"date" yaml:"date"`
+	Commit  string `json:"commit" yaml:"commit"`
+	// Modified is true if the build had uncommitted changes
+	Modified     bool         `json:"modified" yaml:"modified"`
+	GoVersion    string       `json:"go_version" yaml:"go_version"`
+	OS           string       `json:"os" yaml:"os"`
+	Arch         string       `json:"arch" yaml:"arch"`
+	Dependencies []Dependency `json:"dependencies" yaml:"dependencies"`
+}
+
+// Dependency is a module the binary was built with.
+type Dependency struct {
+	Path    string `json:"path" yaml:"path"`
+	Version string `json:"version" yaml:"version"`
+}
+
+var info struct {
+	once sync.Once
+	Info
 }
 
 // GetInfo gets version stamp information.
+// Values that aren't set by the linker are read from the build info embedded
+// by the go command, e.g. for go install, and default to 0.0.0 and undefined.
 func GetInfo() Info {
-	if ver == "" {
-		ver = "0.0.0"
+	info.once.Do(func() {
+		info.Info = Info{
+			Version:      ver,
+			Date:         date,
+			Commit:       commit,
+			GoVersion:    runtime.Version(),
+			OS:           runtime.GOOS,
+			Arch:         runtime.GOARCH,
+			Dependencies: []Dependency{},
+		}
+
+		if buildInfo, ok := debug.ReadBuildInfo(); ok {
+			info.fromBuildInfo(buildInfo)
+		}
+
+		if info.Version == "" {
+			info.Version = "0.0.0"
+		}
+
+		if info.Date == "" {
+			info.Date = "undefined"
+		}
+
+		if info.Commit == "" {
+			info.Commit = "undefined"
+		}
+	})
+
+	// the dependencies are shared by all callers
+	result := info.Info
+	result.Dependencies = append([]Dependency{}, info.Dependencies...)
+
+	return result
+}
+
+// fromBuildInfo sets the values that aren't set yet from the build info.
+func (vi *Info) fromBuildInfo(buildInfo *debug.BuildInfo) {
+	if vi.Version == "" && buildInfo.Main.Version != "(devel)" {
+		vi.Version = strings.TrimPrefix(buildInfo.Main.Version, "v")
 	}
 
-	if date == "" {
-		date = time.Now().Format(time.RFC3339)
+	settings := buildSettings(buildInfo)
+
+	if revision := settings["vcs.revision"]; vi.Commit == "" && revision != "" {
+		vi.Commit = revision
+		if len(vi.Commit) > shortCommitLength {
+			vi.Commit = vi.Commit[:shortCommitLength]
+		}
 	}
 
-	if commit == "" {
-		commit = "undefined"
+	if vi.Date == "" {
+		vi.Date = settings["vcs.time"]
 	}
 
-	return Info{
-		Version: ver,
-		Date:    date,
-		Commit:  commit,
+	vi.Modified = settings["vcs.modified"] == "true"
+
+	for _, dep := range buildInfo.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		vi.Dependencies = append(vi.Dependencies, Dependency{Path: dep.Path, Version: dep.Version})
 	}
 }
 
@@ -46,8 +115,8 @@ func (vi Info) String() string {
 	return fmt.Sprintf("%s g%s %s-%s [%s]",
 		vi.Version,
 		vi.Commit,
-		runtime.GOOS,
-		runtime.GOARCH,
+		vi.OS,
+		vi.Arch,
 		vi.Date,
 	)
 }
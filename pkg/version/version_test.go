@@ -0,0 +1,103 @@
+//go:build go1.18
+// +build go1.18
+
+package version
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const revision = "0123456789abcdef0123456789abcdef01234567"
+
+func newBuildInfo(mainVersion string, settings ...debug.BuildSetting) *debug.BuildInfo {
+	return &debug.BuildInfo{
+		Main: debug.Module{Path: "github.com/aserto-dev/go-sample-project", Version: mainVersion},
+		Deps: []*debug.Module{
+			{Path: "github.com/pkg/errors", Version: "v0.9.1"},
+			{
+				Path:    "github.com/rs/zerolog",
+				Version: "v1.26.1",
+				Replace: &debug.Module{Path: "github.com/fork/zerolog", Version: "v1.26.2"},
+			},
+		},
+		Settings: settings,
+	}
+}
+
+func TestFromBuildInfo(t *testing.T) {
+	assert := require.New(t)
+	vi := Info{}
+
+	vi.fromBuildInfo(newBuildInfo("v1.2.3",
+		debug.BuildSetting{Key: "vcs.revision", Value: revision},
+		debug.BuildSetting{Key: "vcs.time", Value: "2022-03-01T10:00:00Z"},
+	))
+
+	assert.Equal("1.2.3", vi.Version)
+	assert.Equal("0123456", vi.Commit)
+	assert.Equal("2022-03-01T10:00:00Z", vi.Date)
+	assert.False(vi.Modified)
+	assert.Equal([]Dependency{
+		{Path: "github.com/pkg/errors", Version: "v0.9.1"},
+		{Path: "github.com/fork/zerolog", Version: "v1.26.2"},
+	}, vi.Dependencies)
+}
+
+func TestFromBuildInfoShortRevision(t *testing.T) {
+	assert := require.New(t)
+	vi := Info{}
+
+	vi.fromBuildInfo(newBuildInfo("v1.2.3", debug.BuildSetting{Key: "vcs.revision", Value: "abc"}))
+
+	assert.Equal("abc", vi.Commit)
+}
+
+func TestFromBuildInfoModified(t *testing.T) {
+	assert := require.New(t)
+	vi := Info{}
+
+	vi.fromBuildInfo(newBuildInfo("v1.2.3",
+		debug.BuildSetting{Key: "vcs.revision", Value: revision},
+		debug.BuildSetting{Key: "vcs.modified", Value: "true"},
+	))
+
+	assert.True(vi.Modified)
+}
+
+func TestFromBuildInfoLdflags(t *testing.T) {
+	assert := require.New(t)
+	vi := Info{Version: "2.0.0", Commit: "fedcba9", Date: "2022-04-01T00:00:00Z"}
+
+	vi.fromBuildInfo(newBuildInfo("v1.2.3",
+		debug.BuildSetting{Key: "vcs.revision", Value: revision},
+		debug.BuildSetting{Key: "vcs.time", Value: "2022-03-01T10:00:00Z"},
+	))
+
+	assert.Equal("2.0.0", vi.Version)
+	assert.Equal("fedcba9", vi.Commit)
+	assert.Equal("2022-04-01T00:00:00Z", vi.Date)
+}
+
+func TestFromBuildInfoDevel(t *testing.T) {
+	assert := require.New(t)
+	vi := Info{}
+
+	vi.fromBuildInfo(newBuildInfo("(devel)"))
+
+	assert.Empty(vi.Version)
+	assert.Empty(vi.Commit)
+	assert.Empty(vi.Date)
+}
+
+func TestGetInfoCopiesDependencies(t *testing.T) {
+	assert := require.New(t)
+	first := GetInfo()
+	assert.NotEmpty(first.Dependencies)
+
+	first.Dependencies[0].Path = "changed"
+
+	assert.NotEqual("changed", GetInfo().Dependencies[0].Path)
+}